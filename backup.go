@@ -0,0 +1,227 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// parseCategories parses comma separated list of backup part categories
+// (all if empty)
+func parseCategories(s string) (map[string]bool, error) {
+	categories := map[string]bool{}
+	if s == "" {
+		for _, c := range logue.BackupCategories {
+			categories[c] = true
+		}
+		return categories, nil
+	}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		known := false
+		for _, k := range logue.BackupCategories {
+			known = known || c == k
+		}
+		if !known {
+			return nil, argumentError("Unknown part '%s' (%s)", c, strings.Join(logue.BackupCategories, ", "))
+		}
+		categories[c] = true
+	}
+	return categories, nil
+}
+
+func runBackup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	only := fs.String("only", "", "Back up only these parts: "+strings.Join(logue.BackupCategories, ",")+".")
+
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return argumentError("Expected backup file")
+	}
+	categories, err := parseCategories(*only)
+	if err != nil {
+		return err
+	}
+
+	names, err := logue.BackupParts(ctx)
+	if err != nil {
+		return err
+	}
+
+	var selected []string
+	for _, name := range names {
+		if categories[logue.BackupCategory(name)] {
+			selected = append(selected, name)
+		}
+	}
+
+	parts := map[string][]byte{}
+	counts := map[string]int{}
+	err = eachWithProgress(len(selected),
+		func(i int) string { return fmt.Sprintf("Backing up %d/%d %s", i+1, len(selected), selected[i]) },
+		func(i int) error {
+			data, err := logue.ReadBackupPart(ctx, selected[i])
+			if err != nil {
+				return err
+			}
+			parts[selected[i]] = data
+			if data != nil {
+				counts[logue.BackupCategory(selected[i])]++
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if err := logue.SaveBackup(files[0], parts); err != nil {
+		return err
+	}
+	fmt.Printf("\nBackup '%s' saved:", files[0])
+	for _, c := range logue.BackupCategories {
+		if categories[c] {
+			fmt.Printf(" %s %d", c, counts[c])
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// restoreChange is a part that differs on device from backup
+type restoreChange struct {
+	name string
+	from string
+	to   string
+}
+
+func runRestore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	only := fs.String("only", "", "Restore only these parts: "+strings.Join(logue.BackupCategories, ",")+".")
+	programRange := fs.String("range", "1-500", "Programs to restore.")
+	verify := fs.Bool("verify", true, "Read written parts back and compare.")
+	dryRun := fs.Bool("n", false, "Only show what would change.")
+
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return argumentError("Expected backup file")
+	}
+	categories, err := parseCategories(*only)
+	if err != nil {
+		return err
+	}
+	first, last, err := parseProgramRange(*programRange)
+	if err != nil {
+		return err
+	}
+
+	manifest, parts, err := logue.LoadBackup(files[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup of %s from %s\n", manifest.Device, manifest.Created.Local().Format("2006-01-02 15:04"))
+
+	var names []string
+	for _, name := range manifest.Names() {
+		if !categories[logue.BackupCategory(name)] {
+			continue
+		}
+		var n int
+		if _, err := fmt.Sscanf(name, logue.BackupPrograms+"/%d", &n); err == nil && (n < first || n > last) {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	var changes []restoreChange
+	err = eachWithProgress(len(names),
+		func(i int) string { return fmt.Sprintf("Restoring %d/%d %s", i+1, len(names), names[i]) },
+		func(i int) error {
+			name := names[i]
+			current, err := logue.ReadBackupPart(ctx, name)
+			if err == nil && !bytes.Equal(current, parts[name]) {
+				changes = append(changes, restoreChange{name, describePart(name, current), describePart(name, parts[name])})
+				if !*dryRun {
+					err = restorePart(ctx, name, parts[name], *verify)
+				}
+			}
+			return err
+		})
+
+	printRestoreSummary(changes, len(names), *dryRun)
+	return err
+}
+
+// restorePart writes part to device and optionally reads it back for comparison
+func restorePart(ctx context.Context, name string, data []byte, verify bool) error {
+	if err := logue.WriteBackupPart(ctx, name, data); err != nil {
+		return err
+	}
+	if !verify {
+		return nil
+	}
+	written, err := logue.ReadBackupPart(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(written, data) {
+		return &logue.Error{Class: logue.ErrCommunication, Op: fmt.Sprintf("Verification of '%s' failed", name)}
+	}
+	return nil
+}
+
+// describePart returns short description of part data for change summary
+func describePart(name string, data []byte) string {
+	switch logue.BackupCategory(name) {
+	case logue.BackupPrograms:
+		if prog, err := logue.DecodeProgram(data); err == nil {
+			return fmt.Sprintf("'%s'", prog.Name)
+		}
+	case logue.BackupUser:
+		if data == nil {
+			return "empty"
+		}
+		if mod, err := logue.DecodeModule(data); err == nil {
+			return fmt.Sprintf("'%s' %s", mod.Header.Name, mod.Header.Version.VersionString())
+		}
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%d bytes (%x)", len(data), sum[:4])
+}
+
+func printRestoreSummary(changes []restoreChange, total int, dryRun bool) {
+	verb := "Changed"
+	if dryRun {
+		verb = "Would change"
+	}
+	fmt.Printf("\n%s %d of %d parts\n", verb, len(changes), total)
+	for _, c := range changes {
+		fmt.Printf("  %-16s %s -> %s\n", c.name, c.from, c.to)
+	}
+}
@@ -0,0 +1,458 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// command is run with the arguments following its name
+// (e.g. "dialogue program export x.prlgprog")
+type command struct {
+	usage  string
+	device func(args []string) bool // Tells if connection to device is needed (nil = never)
+	run    func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"program": {
+		usage: "program export <file.prlgprog | file.prlglib#n> [-f yaml|json]\n" +
+			"program import <file.yaml|json> -o <file.prlgprog | file.prlglib#n>",
+		run: runProgram,
+	},
+	"diff": {
+		usage:  "diff <file.prlgprog | program number | edit> <file.prlgprog | program number | edit> [-json]",
+		device: anyProgramSlot,
+		run:    runDiff,
+	},
+	"rename": {
+		usage:  "rename <file.prlgprog | program number | edit> [new name]",
+		device: renameNeedsDevice,
+		run:    runRename,
+	},
+	"list": {
+		usage:  "list [first-last] [-csv | -json] [-cached] [-cache <file>]",
+		device: listNeedsDevice,
+		run:    runList,
+	},
+	"search": {
+		usage:  "search <query> [folder | file | device ...] [-range first-last]",
+		device: searchNeedsDevice,
+		run:    runSearch,
+	},
+	"random": {
+		usage: "random [-profile <file.json>] [-seed N] [-base <file.prlgprog>] [-dir <folder>]\n" +
+			"random derive -o <file.json> <folder | file ...>",
+		device: randomNeedsDevice,
+		run:    runRandom,
+	},
+	"morph": {
+		usage:  "morph <A> <B> [-steps N] [-time 5s] [-cc N] [-threshold 0.5]   (A, B: file.prlgprog | program number | edit)",
+		device: func(args []string) bool { return true },
+		run:    runMorph,
+	},
+	"timbre": {
+		usage: "timbre copy <main | sub> <program> [-o <program>]   (copies over the other timbre)\n" +
+			"timbre swap <program> [-o <program>]\n" +
+			"timbre layer <A> <B> -o <program>   (main timbres of A and B layered)\n" +
+			"timbre extract <main | sub> <program> -o <program>",
+		device: anyProgramSlot,
+		run:    runTimbre,
+	},
+	"sheet": {
+		usage: "sheet <folder | file.prlgprog | file.prlglib ...> [-f md|html] [-o <file>]",
+		run:   runSheet,
+	},
+	"lint": {
+		usage:  "lint <folder | file | program number | edit ...> [-slots] [-fix]   (-slots checks user slots on device)",
+		device: lintNeedsDevice,
+		run:    runLint,
+	},
+	"deps": {
+		usage:  "deps [folder | file ...] [-range first-last] [-cached] [-slot <module/slot | module>] [-json]   (programs using user slots)",
+		device: depsNeedsDevice,
+		run:    runDeps,
+	},
+	"info": {
+		usage: "info <folder | file ...>   (lists programmer & comment)\n" +
+			"info <file> [-n N] [-programmer <text>] [-comment <text>]",
+		run: runInfo,
+	},
+	"backup": {
+		usage:  "backup <file> [-only programs,user,global,tuning,liveset]",
+		device: func(args []string) bool { return true },
+		run:    runBackup,
+	},
+	"restore": {
+		usage:  "restore <file> [-only programs,user,global,tuning,liveset] [-range first-last] [-verify=false] [-n]   (-n: only show changes)",
+		device: func(args []string) bool { return true },
+		run:    runRestore,
+	},
+}
+
+func printCommandUsage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(flag.CommandLine.Output(), "\nCommands:\n")
+	for _, name := range names {
+		for _, line := range strings.Split(commands[name].usage, "\n") {
+			fmt.Fprintf(flag.CommandLine.Output(), "  dialogue %s\n", line)
+		}
+	}
+}
+
+func argumentError(format string, a ...interface{}) error {
+	return &logue.Error{Class: logue.ErrArgument, Op: fmt.Sprintf(format, a...)}
+}
+
+func fileError(err error, format string, a ...interface{}) error {
+	return &logue.Error{Class: logue.ErrFile, Op: fmt.Sprintf(format, a...), Err: err}
+}
+
+// parseArgs parses flags given before or after the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, argumentError("%s", err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func runProgram(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return argumentError("Missing program command (export, import)")
+	}
+
+	fs := flag.NewFlagSet("program "+args[0], flag.ContinueOnError)
+	format := fs.String("f", logue.FormatYAML, "Output format: yaml, json.")
+	output := fs.String("o", "", "Output file.")
+
+	files, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return argumentError("Expected one file, got %d", len(files))
+	}
+
+	switch args[0] {
+	case "export":
+		data, info, err := loadProgramFile(files[0])
+		if err != nil {
+			return err
+		}
+		return logue.ExportProgram(os.Stdout, data, info, *format)
+
+	case "import":
+		if *output == "" {
+			return argumentError("Missing output file (-o)")
+		}
+		f, err := os.Open(files[0])
+		if err != nil {
+			return fileError(err, "Cannot open '%s'", files[0])
+		}
+		defer f.Close()
+
+		data, info, err := logue.ImportProgram(f)
+		if err != nil {
+			return err
+		}
+		if err := saveProgramFile(*output, data, &info); err != nil {
+			return err
+		}
+		fmt.Printf("Program '%s' saved to '%s'\n", files[0], *output)
+		return nil
+	}
+
+	return argumentError("Unknown program command '%s'", args[0])
+}
+
+// isProgramSlot tells if argument refers to program on device (number or
+// "edit" for the edit buffer) instead of a file
+func isProgramSlot(arg string) bool {
+	if _, err := os.Stat(arg); err == nil {
+		return false
+	}
+	if arg == "edit" {
+		return true
+	}
+	_, err := strconv.Atoi(arg)
+	return err == nil
+}
+
+func anyProgramSlot(args []string) bool {
+	for _, arg := range args {
+		if isProgramSlot(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// programSlot returns program number of argument (-1 = edit buffer)
+func programSlot(arg string) (int, error) {
+	if arg == "edit" {
+		return -1, nil
+	}
+	n, _ := strconv.Atoi(arg)
+	if n < 1 || n > 500 {
+		return 0, argumentError("Program number %d is out of range (1-500)", n)
+	}
+	return n, nil
+}
+
+// loadProgram returns program data from file or device
+func loadProgram(ctx context.Context, arg string) ([]byte, error) {
+	if !isProgramSlot(arg) {
+		data, _, err := loadProgramFile(arg)
+		return data, err
+	}
+	n, err := programSlot(arg)
+	if err != nil {
+		return nil, err
+	}
+	return logue.GetProgram(ctx, n)
+}
+
+// loadProgramFile returns program and its metadata from program file, or
+// the chosen program of library file ("file#n")
+func loadProgramFile(arg string) ([]byte, logue.ProgramInfo, error) {
+	var info logue.ProgramInfo
+
+	filename, index, err := splitProgramFile(arg)
+	if err != nil {
+		return nil, info, err
+	}
+	programs, err := logue.LoadPrograms(filename)
+	if err != nil {
+		return nil, info, err
+	}
+	if index, err = programIndex(filename, index, len(programs)); err != nil {
+		return nil, info, err
+	}
+	if infos, err := logue.LoadProgramInfo(filename); err == nil && index < len(infos) {
+		info = infos[index]
+	}
+	return programs[index], info, nil
+}
+
+// splitProgramFile splits "file#n" to file name and index of program in
+// library (0 = first, -1 = not given)
+func splitProgramFile(arg string) (string, int, error) {
+	i := strings.LastIndex(arg, "#")
+	if i < 0 {
+		return arg, -1, nil
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return arg, -1, nil
+	}
+	n, err := strconv.Atoi(arg[i+1:])
+	if err != nil || n < 1 {
+		return "", 0, argumentError("Invalid program '%s' in library (file#n, n = 1..)", arg)
+	}
+	return arg[:i], n - 1, nil
+}
+
+// programIndex checks index of program in file with count programs. If not
+// given, file must have only one program.
+func programIndex(filename string, index int, count int) (int, error) {
+	if index < 0 {
+		if count > 1 {
+			return 0, argumentError("'%s' has %d programs, choose one with '%s#<n>'", filename, count, filename)
+		}
+		index = 0
+	}
+	if index >= count {
+		return 0, argumentError("'%s' has %d programs, no program %d", filename, count, index+1)
+	}
+	return index, nil
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Output as JSON.")
+
+	sources, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(sources) != 2 {
+		return argumentError("Expected two programs to compare, got %d", len(sources))
+	}
+
+	a, err := loadProgram(ctx, sources[0])
+	if err != nil {
+		return err
+	}
+	b, err := loadProgram(ctx, sources[1])
+	if err != nil {
+		return err
+	}
+
+	diffs, err := logue.DiffPrograms(a, b)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if diffs == nil {
+			diffs = []logue.Difference{}
+		}
+		out, _ := json.MarshalIndent(struct {
+			A           string             `json:"a"`
+			B           string             `json:"b"`
+			Differences []logue.Difference `json:"differences"`
+		}{sources[0], sources[1], diffs}, "", "  ")
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if len(diffs) == 0 {
+		fmt.Printf("Programs are identical\n")
+		return nil
+	}
+
+	fmt.Printf("--- %s\n+++ %s\n", sources[0], sources[1])
+	section := ""
+	for _, d := range diffs {
+		title, name, change := "Program", d.Name, d.A+" -> "+d.B
+		if i := strings.Index(d.Name, "."); i > 0 {
+			switch d.Name[:i] {
+			case "main", "sub":
+				title, name = strings.Title(d.Name[:i])+" timbre", d.Name[i+1:]
+			case "unknown":
+				title, name = "Unknown bytes", "offset "+d.Name[i+1:]
+				n := 0
+				for j := 0; j+1 < len(d.A) && j+1 < len(d.B); j += 2 {
+					if d.A[j:j+2] != d.B[j:j+2] {
+						n++
+					}
+				}
+				change = fmt.Sprintf("%d of %d bytes differ", n, len(d.A)/2)
+			}
+		}
+		if title != section {
+			fmt.Printf("\n%s:\n", title)
+			section = title
+		}
+		fmt.Printf("  %-28s %s\n", name, change)
+	}
+	return nil
+}
+
+// saveProgram writes program to device or file (see saveProgramFile)
+func saveProgram(ctx context.Context, arg string, data []byte) error {
+	if !isProgramSlot(arg) {
+		return saveProgramFile(arg, data, nil)
+	}
+	n, err := programSlot(arg)
+	if err != nil {
+		return err
+	}
+	return logue.SetProgram(ctx, n, data)
+}
+
+// saveProgramFile writes program to file. In existing program or library
+// file only the chosen program ("file#n") is replaced; other programs and
+// metadata are kept unless info is given.
+func saveProgramFile(arg string, data []byte, info *logue.ProgramInfo) error {
+	filename, index, err := splitProgramFile(arg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		if index > 0 {
+			return argumentError("'%s' does not exist, cannot save program #%d", filename, index+1)
+		}
+		if info != nil {
+			return logue.SaveProgramFileWithInfo(filename, data, *info)
+		}
+		return logue.SaveProgramFile(filename, data)
+	}
+
+	programs, err := logue.LoadPrograms(filename)
+	if err != nil {
+		return err
+	}
+	if index, err = programIndex(filename, index, len(programs)); err != nil {
+		return err
+	}
+	programs[index] = data
+	if err := logue.UpdateProgramFile(filename, programs); err != nil {
+		return err
+	}
+	if info != nil {
+		return logue.UpdateProgramInfo(filename, index, *info)
+	}
+	return nil
+}
+
+// renameNeedsDevice tells if renamed program is on device (new name may
+// be a number too)
+func renameNeedsDevice(args []string) bool {
+	return len(args) > 0 && isProgramSlot(args[0])
+}
+
+func runRename(ctx context.Context, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return argumentError("Expected program and new name")
+	}
+
+	data, err := loadProgram(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	prog, err := logue.DecodeProgram(data)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		fmt.Printf("%s\n", prog.Name)
+		return nil
+	}
+
+	data, err = logue.RenameProgram(data, args[1])
+	if err != nil {
+		return err
+	}
+	if err := saveProgram(ctx, args[0], data); err != nil {
+		return err
+	}
+	fmt.Printf("\nProgram '%s' renamed to '%s'\n", prog.Name, args[1])
+	return nil
+}
@@ -0,0 +1,264 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dependent is a program using a user slot
+type dependent struct {
+	Program string `json:"program"` // Program number or file
+	Name    string `json:"name"`
+	Param   string `json:"param"`
+}
+
+// dependencies maps user slots (e.g. "osc/2") to programs using them
+type dependencies map[string][]dependent
+
+func (d dependencies) add(program string, name string, refs []logue.SlotRef) {
+	for _, ref := range refs {
+		d[ref.String()] = append(d[ref.String()], dependent{program, name, ref.Name})
+	}
+}
+
+// only returns dependencies of module slot ("osc/2") or all slots of
+// module ("osc")
+func (d dependencies) only(moduleSlot string) dependencies {
+	filtered := dependencies{}
+	for slot, list := range d {
+		if slot == moduleSlot || strings.HasPrefix(slot, moduleSlot+"/") {
+			filtered[slot] = list
+		}
+	}
+	return filtered
+}
+
+func (d dependencies) slots() []string {
+	var slots []string
+	for slot := range d {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		mi, si, _, _ := logue.ParseModuleSlot(slots[i])
+		mj, sj, _, _ := logue.ParseModuleSlot(slots[j])
+		return mi < mj || mi == mj && si < sj
+	})
+	return slots
+}
+
+func summaryDependencies(list []programSummary) dependencies {
+	deps := dependencies{}
+	for _, s := range list {
+		deps.add(strconv.Itoa(s.Number), s.Name, s.UserSlots)
+	}
+	return deps
+}
+
+// depsNeedsDevice tells if programs are read from device (no files or
+// folders given)
+func depsNeedsDevice(args []string) bool {
+	for _, arg := range args {
+		if arg == "-cached" || arg == "--cached" {
+			return false
+		}
+		if _, err := os.Stat(arg); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func runDeps(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("deps", flag.ContinueOnError)
+	programRange := fs.String("range", "1-500", "Program range on device.")
+	slot := fs.String("slot", "", "Show only programs using module slot (e.g. osc/2) or module (e.g. osc).")
+	asJSON := fs.Bool("json", false, "Output as JSON.")
+	cached := fs.Bool("cached", false, "Use programs listed last time instead of reading the device.")
+
+	sources, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	deps := dependencies{}
+	if len(sources) > 0 {
+		if deps, err = fileDependencies(sources); err != nil {
+			return err
+		}
+	} else {
+		first, last, err := parseProgramRange(*programRange)
+		if err != nil {
+			return err
+		}
+		cacheFile := defaultListCacheFile()
+		cache := loadListCache(cacheFile)
+		var list []programSummary
+		if *cached {
+			list = cachedSummaries(cache, first, last)
+		} else if list, err = readSummaries(ctx, cache, cacheFile, first, last); err != nil {
+			return err
+		}
+		deps = summaryDependencies(list)
+	}
+
+	if *slot != "" {
+		if _, _, _, err := logue.ParseModuleSlot(*slot); err != nil {
+			return err
+		}
+		deps = deps.only(*slot)
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(deps, "", "  ")
+		fmt.Println(string(out))
+		return nil
+	}
+	if len(deps) == 0 {
+		fmt.Printf("No programs use user slots\n")
+		return nil
+	}
+	for _, s := range deps.slots() {
+		fmt.Printf("%s:\n", s)
+		for _, d := range deps[s] {
+			fmt.Printf("  %-5s %-12s  %s\n", d.Program, d.Name, d.Param)
+		}
+	}
+	return nil
+}
+
+// fileDependencies returns user slot dependencies of programs in files and folders
+func fileDependencies(sources []string) (dependencies, error) {
+	deps := dependencies{}
+	for _, source := range sources {
+		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fileError(err, "Cannot read '%s'", path)
+			}
+			if info.IsDir() || !isProgramFile(path) {
+				return nil
+			}
+			programs, err := logue.LoadPrograms(path)
+			if err != nil {
+				return err
+			}
+			for i, data := range programs {
+				prog, err := logue.DecodeProgram(data)
+				if err != nil {
+					return err
+				}
+				refs, err := logue.ProgramSlotRefs(data)
+				if err != nil {
+					return err
+				}
+				program := path
+				if len(programs) > 1 {
+					program = fmt.Sprintf("%s#%d", path, i+1)
+				}
+				deps.add(program, prog.Name, refs)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
+
+// cachedSummaries returns cached summaries of programs first-last
+func cachedSummaries(cache *listCache, first int, last int) []programSummary {
+	var list []programSummary
+	for n := first; n <= last; n++ {
+		if s, ok := cache.Programs[cache.Slots[strconv.Itoa(n)]]; ok {
+			s.Number = n
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// depsCheck tells how programs using a slot are checked before uw/ud
+type depsCheck struct {
+	programRange string // Programs to read (first-last)
+	cached       bool   // Use programs listed last time
+	yes          bool   // Do not ask for confirmation
+}
+
+// warnDependents prints programs on device that use module slot before it
+// is deleted or replaced and asks for confirmation if there are any (unless
+// check.yes is set or stdin is not a terminal). By default programs are read
+// from the device, as the last listing may be older than the programs; the
+// cache only saves decoding. If the programs cannot be read, the slot is
+// changed anyway after a warning.
+func warnDependents(ctx context.Context, moduleSlot string, check depsCheck) error {
+	first, last, err := parseProgramRange(check.programRange)
+	if err != nil {
+		return err
+	}
+	cacheFile := defaultListCacheFile()
+	cache := loadListCache(cacheFile)
+
+	var list []programSummary
+	if check.cached {
+		list = cachedSummaries(cache, first, last)
+	} else {
+		fmt.Fprintf(os.Stderr, "Checking programs using '%s'...\n", moduleSlot)
+		if list, err = readSummaries(ctx, cache, cacheFile, first, last); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "WARNING: Cannot check programs using '%s': %s\n", moduleSlot, err)
+			return nil
+		}
+	}
+
+	deps := summaryDependencies(list).only(moduleSlot)
+	if len(deps) == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "WARNING: Programs using '%s' will change:\n", moduleSlot)
+	for _, s := range deps.slots() {
+		for _, d := range deps[s] {
+			fmt.Fprintf(os.Stderr, "  %-7s %-5s %-12s  %s\n", s, d.Program, d.Name, d.Param)
+		}
+	}
+	if check.yes || !isTerminal(os.Stdin) {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Continue? [y/N]: ")
+	select {
+	case line := <-readLines(os.Stdin):
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer == "y" || answer == "yes" {
+			return nil
+		}
+		return context.Canceled
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,103 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func runInfo(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	number := fs.Int("n", 1, "Program in library file to edit (1 = first).")
+	programmer := fs.String("programmer", "", "Set programmer.")
+	comment := fs.String("comment", "", "Set comment.")
+
+	sources, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return argumentError("Missing program file")
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["programmer"] || set["comment"] {
+		if len(sources) != 1 {
+			return argumentError("Expected one file to edit, got %d", len(sources))
+		}
+		return editInfo(sources[0], *number-1, set, *programmer, *comment)
+	}
+
+	fmt.Printf("%-30s  %-12s  %-20s  %s\n", "Program", "Name", "Programmer", "Comment")
+	for _, source := range sources {
+		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fileError(err, "Cannot read '%s'", path)
+			}
+			if info.IsDir() || !isProgramFile(path) {
+				return nil
+			}
+			programs, err := sheetPrograms(path)
+			if err != nil {
+				return err
+			}
+			for _, p := range programs {
+				prog, err := logue.DecodeProgram(p.Data)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%-30s  %-12s  %-20s  %s\n", p.Source, prog.Name, p.Info.Programmer, p.Info.Comment)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editInfo sets programmer and/or comment of program in file
+func editInfo(filename string, index int, set map[string]bool, programmer string, comment string) error {
+	infos, err := logue.LoadProgramInfo(filename)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(infos) {
+		return argumentError("'%s' has %d programs, no program %d", filename, len(infos), index+1)
+	}
+
+	info := infos[index]
+	if set["programmer"] {
+		info.Programmer = programmer
+	}
+	if set["comment"] {
+		info.Comment = comment
+	}
+	if err := logue.UpdateProgramInfo(filename, index, info); err != nil {
+		return err
+	}
+	fmt.Printf("Program info of '%s' updated\n", filename)
+	return nil
+}
@@ -18,6 +18,7 @@
 package dialogue
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 )
@@ -28,12 +29,12 @@ type ProgramData struct {
 }
 
 type Contents struct {
-	NumLivesetData       int         `xml:"NumLivesetData,attr"`
-	NumProgramData       int         `xml:"NumProgramData,attr"`
-	NumPresetInformation int         `xml:"NumPresetInformation,attr"`
-	NumTuneScaleData     int         `xml:"NumTuneScaleData,attr"`
-	NumTuneOctData       int         `xml:"NumTuneOctData,attr"`
-	ProgramData          ProgramData `xml:"ProgramData"`
+	NumLivesetData       int           `xml:"NumLivesetData,attr"`
+	NumProgramData       int           `xml:"NumProgramData,attr"`
+	NumPresetInformation int           `xml:"NumPresetInformation,attr"`
+	NumTuneScaleData     int           `xml:"NumTuneScaleData,attr"`
+	NumTuneOctData       int           `xml:"NumTuneOctData,attr"`
+	ProgramData          []ProgramData `xml:"ProgramData"`
 }
 
 type Korg struct {
@@ -42,20 +43,37 @@ type Korg struct {
 	Contents Contents `xml:"Contents"`
 }
 
-func createFileInformationXML(product string) string {
+// Name of the contents list in program and library packages
+const fileInformationFileName = "FileInformation.xml"
+
+func parseFileInformationXML(data []byte) (Korg, error) {
+	var korg Korg
+	err := xml.Unmarshal(data, &korg)
+	return korg, err
+}
+
+// programEntryName returns name of n:th program's file in package (e.g. "Prog_000.prog_bin")
+func programEntryName(n int, extension string) string {
+	return fmt.Sprintf("Prog_%03d%s", n, extension)
+}
+
+func createFileInformationXML(product string, numPrograms int, dataExtension string) string {
 	korg := &Korg{
 		Product: product,
 		Contents: Contents{
 			NumLivesetData:       0,
-			NumProgramData:       1,
+			NumProgramData:       numPrograms,
 			NumPresetInformation: 0,
 			NumTuneScaleData:     0,
 			NumTuneOctData:       0,
-			ProgramData: ProgramData{
-				Information: "Prog_000.prog_info", ProgramBinary: "Prog_000.prog_bin",
-			},
 		},
 	}
+	for i := 0; i < numPrograms; i++ {
+		korg.Contents.ProgramData = append(korg.Contents.ProgramData, ProgramData{
+			Information:   programEntryName(i, programInfoFileExtension),
+			ProgramBinary: programEntryName(i, dataExtension),
+		})
+	}
 
 	out, _ := xml.MarshalIndent(korg, " ", "  ")
 	xmlStr := xml.Header + string(out)
@@ -67,8 +85,26 @@ func createProgramInfoXML(device string, programmer string, comment string) stri
 	var outXML string
 	outXML =  xml.Header + 
 			  fmt.Sprintf("<%s_ProgramInformation>\n", device) +
-			  fmt.Sprintf("  <Programmer>%s</Programmer>\n", programmer) +
-			  fmt.Sprintf("  <Comment>%s</Comment>\n", comment) +
+			  fmt.Sprintf("  <Programmer>%s</Programmer>\n", escapeXML(programmer)) +
+			  fmt.Sprintf("  <Comment>%s</Comment>\n", escapeXML(comment)) +
 			  fmt.Sprintf("</%s_ProgramInformation>\n", device)
 	return outXML
 }
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// ProgramInfo is the metadata of a program in program package ("Prog_NNN.prog_info")
+type ProgramInfo struct {
+	Programmer string `xml:"Programmer"`
+	Comment    string `xml:"Comment"`
+}
+
+func parseProgramInfoXML(data []byte) (ProgramInfo, error) {
+	var info ProgramInfo
+	err := xml.Unmarshal(data, &info)
+	return info, err
+}
@@ -0,0 +1,300 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sysex "dialogue/internal/pkg/dialogue/sysex"
+	sysexMessageType "dialogue/internal/pkg/dialogue/sysex/message"
+)
+
+// Backup archive is a zip package with 'manifest.json' and one '<part>.bin'
+// file per backed up part of device memory. Parts are named by category:
+//
+//   programs/001 .. programs/500
+//   user/osc/0 ..           (user slots of every module)
+//   global
+//   tuning/scale/0 .., tuning/octave/0 ..
+//   liveset
+
+// Backup archive format and its current version
+const (
+	BackupFormat  = "dialogue-backup"
+	BackupVersion = 1
+)
+
+// Backup part categories
+const (
+	BackupPrograms = "programs"
+	BackupUser     = "user"
+	BackupGlobal   = "global"
+	BackupTuning   = "tuning"
+	BackupLiveset  = "liveset"
+)
+
+// BackupCategories lists all part categories in backup & restore order
+var BackupCategories = []string{BackupPrograms, BackupUser, BackupGlobal, BackupTuning, BackupLiveset}
+
+// BackupManifest describes contents of backup archive
+type BackupManifest struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Device  string    `json:"device"`
+	Created time.Time `json:"created"`
+
+	// SHA-256 of each part as hex. Empty user slots have empty hash and no file.
+	Parts map[string]string `json:"parts"`
+}
+
+// Names returns part names of manifest in backup & restore order
+func (m BackupManifest) Names() []string {
+	var names []string
+	for name := range m.Parts {
+		names = append(names, name)
+	}
+	sortBackupParts(names)
+	return names
+}
+
+func sortBackupParts(names []string) {
+	order := map[string]int{}
+	for i, c := range BackupCategories {
+		order[c] = i
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		ci, cj := BackupCategory(names[i]), BackupCategory(names[j])
+		if ci != cj {
+			return order[ci] < order[cj]
+		}
+		return names[i] < names[j]
+	})
+}
+
+// BackupCategory returns category of part name
+func BackupCategory(name string) string {
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// BackupParts returns names of all parts of device memory. Slot counts
+// of user modules are asked from the device.
+func BackupParts(ctx context.Context) ([]string, error) {
+	info := dlg.getDeviceSpecificInfo()
+	var names []string
+
+	for n := info.programRange.min; n <= info.programRange.max; n++ {
+		names = append(names, fmt.Sprintf("%s/%03d", BackupPrograms, n))
+	}
+	for _, module := range []string{"osc", "modfx", "delfx", "revfx"} {
+		mi, err := ReadUserModuleInfo(ctx, module)
+		if err != nil {
+			return nil, err
+		}
+		for slot := 0; slot < int(mi.SlotCount); slot++ {
+			names = append(names, fmt.Sprintf("%s/%s/%d", BackupUser, module, slot))
+		}
+	}
+	names = append(names, BackupGlobal)
+	for n := 0; n < info.tuningScaleCount; n++ {
+		names = append(names, fmt.Sprintf("%s/scale/%d", BackupTuning, n))
+	}
+	for n := 0; n < info.tuningOctaveCount; n++ {
+		names = append(names, fmt.Sprintf("%s/octave/%d", BackupTuning, n))
+	}
+	names = append(names, BackupLiveset)
+
+	sortBackupParts(names)
+	return names, nil
+}
+
+// backupPart is the dump request & write messages of a part
+type backupPart struct {
+	request byte
+	dump    byte
+	header  []byte
+	program int    // Program number of program part
+	slot    string // Module slot of user part
+}
+
+func parseBackupPart(name string) (backupPart, error) {
+	fields := strings.Split(name, "/")
+	number := -1
+	if len(fields) > 1 {
+		if n, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			number = n
+		}
+	}
+	info := dlg.getDeviceSpecificInfo()
+
+	switch {
+	case len(fields) == 2 && fields[0] == BackupPrograms && info.programRange.has(number):
+		return backupPart{program: number}, nil
+	case len(fields) == 3 && fields[0] == BackupUser && sysex.ModuleID(fields[1]) > 0 && number >= 0:
+		return backupPart{slot: fields[1] + "/" + fields[2]}, nil
+	case name == BackupGlobal:
+		return backupPart{request: sysexMessageType.GlobalDataDumpRequest, dump: sysexMessageType.GlobalDataDump}, nil
+	case len(fields) == 3 && fields[0] == BackupTuning && fields[1] == "scale" && number >= 0 && number < info.tuningScaleCount:
+		return backupPart{
+			request: sysexMessageType.TuningScaleDataDumpRequest,
+			dump:    sysexMessageType.TuningScaleDataDump,
+			header:  []byte{byte(number)},
+		}, nil
+	case len(fields) == 3 && fields[0] == BackupTuning && fields[1] == "octave" && number >= 0 && number < info.tuningOctaveCount:
+		return backupPart{
+			request: sysexMessageType.TuningOctaveDataDumpRequest,
+			dump:    sysexMessageType.TuningOctaveDataDump,
+			header:  []byte{byte(number)},
+		}, nil
+	case name == BackupLiveset:
+		return backupPart{request: sysexMessageType.LivesetDataDumpRequest, dump: sysexMessageType.LivesetDataDump}, nil
+	}
+	return backupPart{}, newError(ErrArgument, nil, "Unknown backup part '%s'", name)
+}
+
+// ReadBackupPart returns data of part from device (nil for empty user slot)
+func ReadBackupPart(ctx context.Context, name string) ([]byte, error) {
+	part, err := parseBackupPart(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case part.program > 0:
+		return ReadProgram(ctx, part.program)
+
+	case part.slot != "":
+		status, err := ReadUserSlotStatus(ctx, part.slot)
+		if err != nil || status.Empty {
+			return nil, err
+		}
+		mod, err := ReadUserSlot(ctx, part.slot)
+		if err != nil {
+			return nil, err
+		}
+		return mod.FromModule(), nil
+	}
+
+	resp := <-getData(ctx, part.request, part.header, nil)
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	if len(resp.data) == 0 {
+		return nil, newError(ErrCommunication, nil, "Received wrong data!")
+	}
+	return resp.data, nil
+}
+
+// WriteBackupPart writes data of part to device (nil clears user slot)
+func WriteBackupPart(ctx context.Context, name string, data []byte) error {
+	part, err := parseBackupPart(name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case part.program > 0:
+		return WriteProgram(ctx, part.program, data)
+	case part.slot != "" && data == nil:
+		return DeleteUserData(ctx, part.slot)
+	case part.slot != "":
+		return WriteUserSlot(ctx, part.slot, data)
+	}
+
+	resp := <-getData(ctx, part.dump, part.header, data)
+	return resp.err
+}
+
+func partFile(name string) string {
+	return name + ".bin"
+}
+
+func partHash(data []byte) string {
+	if data == nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveBackup writes parts (nil = empty user slot) to backup archive
+func SaveBackup(filename string, parts map[string][]byte) error {
+	manifest := BackupManifest{
+		Format:  BackupFormat,
+		Version: BackupVersion,
+		Device:  dlg.getDeviceSpecificInfo().deviceName,
+		Created: time.Now().UTC(),
+		Parts:   map[string]string{},
+	}
+
+	files := map[string][]byte{}
+	for name, data := range parts {
+		manifest.Parts[name] = partHash(data)
+		if data != nil {
+			files[partFile(name)] = data
+		}
+	}
+
+	m, _ := json.MarshalIndent(manifest, "", "  ")
+	files["manifest.json"] = m
+	return createZipFile(filename, files)
+}
+
+// LoadBackup returns manifest and parts of backup archive. Archive format,
+// version, device and checksums of the parts are verified.
+func LoadBackup(filename string) (BackupManifest, map[string][]byte, error) {
+	var manifest BackupManifest
+
+	files, err := getAllDataFromZipFile("", filename)
+	if err != nil {
+		return manifest, nil, err
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil || manifest.Format != BackupFormat {
+		return manifest, nil, newError(ErrFile, err, "'%s' is not a backup archive", filename)
+	}
+	if manifest.Version > BackupVersion {
+		return manifest, nil, newError(ErrFile, nil, "Backup '%s' is version %d, supported up to %d", filename, manifest.Version, BackupVersion)
+	}
+	if manifest.Device != dlg.getDeviceSpecificInfo().deviceName {
+		return manifest, nil, newError(ErrFile, nil, "Backup '%s' is from %s", filename, manifest.Device)
+	}
+
+	parts := map[string][]byte{}
+	for name, hash := range manifest.Parts {
+		if _, err := parseBackupPart(name); err != nil {
+			return manifest, nil, newError(ErrFile, err, "Backup '%s' is damaged", filename)
+		}
+		data, ok := files[partFile(name)]
+		if hash == "" && !ok && BackupCategory(name) == BackupUser {
+			parts[name] = nil
+			continue
+		}
+		if !ok || partHash(data) != hash {
+			return manifest, nil, newError(ErrFile, nil, "Backup '%s' is damaged: '%s' is missing or changed", filename, name)
+		}
+		parts[name] = data
+	}
+	return manifest, parts, nil
+}
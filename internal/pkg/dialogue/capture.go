@@ -0,0 +1,136 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capture file has one SysEx message per line:
+//
+//   <timestamp (RFC 3339)> <direction> <message as hex>
+//
+// Direction is '>' for messages sent to device and '<' for received ones.
+// Empty lines and lines starting with '#' are ignored.
+
+// Direction of a captured message
+type Direction byte
+
+// Message directions
+const (
+	DirectionSent     Direction = '>'
+	DirectionReceived Direction = '<'
+)
+
+// CaptureEntry is a SysEx message sent to or received from device
+type CaptureEntry struct {
+	Time      time.Time
+	Direction Direction
+	Data      []byte
+}
+
+var capture struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// StartCapture starts recording sent & received SysEx messages to w
+func StartCapture(w io.Writer) error {
+	capture.Lock()
+	defer capture.Unlock()
+
+	_, err := fmt.Fprintf(w, "# dialogue SysEx capture, started %s\n", time.Now().Format(time.RFC3339))
+	if err != nil {
+		return newError(ErrFile, err, "Cannot write capture")
+	}
+	capture.w = w
+	return nil
+}
+
+// StopCapture stops recording. It does not close the writer.
+func StopCapture() {
+	capture.Lock()
+	capture.w = nil
+	capture.Unlock()
+}
+
+func captureSysex(dir Direction, data []byte) {
+	capture.Lock()
+	defer capture.Unlock()
+
+	if capture.w == nil {
+		return
+	}
+	_, err := fmt.Fprintf(capture.w, "%s %c %X\n", time.Now().Format(time.RFC3339Nano), dir, data)
+	if err != nil {
+		logf(LogError, "Cannot write capture: %s", err)
+		capture.w = nil
+	}
+}
+
+// ReadCapture reads capture entries from r
+func ReadCapture(r io.Reader) ([]CaptureEntry, error) {
+	var entries []CaptureEntry
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 4*maxSysexSize)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 || len(fields[1]) != 1 {
+			return nil, newError(ErrFile, nil, "Malformed capture line %d", line)
+		}
+
+		var e CaptureEntry
+		var err error
+
+		e.Time, err = time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return nil, newError(ErrFile, err, "Bad timestamp on capture line %d", line)
+		}
+
+		e.Direction = Direction(fields[1][0])
+		if e.Direction != DirectionSent && e.Direction != DirectionReceived {
+			return nil, newError(ErrFile, nil, "Bad direction '%c' on capture line %d", e.Direction, line)
+		}
+
+		e.Data, err = hex.DecodeString(fields[2])
+		if err != nil {
+			return nil, newError(ErrFile, err, "Bad data on capture line %d", line)
+		}
+
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, newError(ErrFile, err, "Cannot read capture")
+	}
+
+	return entries, nil
+}
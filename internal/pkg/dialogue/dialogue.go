@@ -19,8 +19,8 @@ package dialogue
 
 import (
 	//"encoding/hex"
+	"context"
 	"encoding/hex"
-	"fmt"
 	"strings"
 
 	message "dialogue/internal/pkg/dialogue/sysex/message"
@@ -42,14 +42,12 @@ type DeviceSpecificInfo struct {
 	programFilesize          int
 	midiNamePrefix           string
 	programRange             ProgramRange
+	tuningScaleCount         int // User scales
+	tuningOctaveCount        int // User octaves
 }
 
 var dlg Dialogue
 
-var isDebug bool
-
-func EnableDebugging() { isDebug = true }
-
 func Open() error {
 	return initializeMidi()
 }
@@ -74,26 +72,26 @@ func FindMidiIO() (int, int) {
 		findMidiPort(outs, dlg.getDeviceSpecificInfo().midiNamePrefix, "SOUND")
 }
 
-func ListMidiPorts() {
-
-	ins, outs := getMidiPortNames()
-
-	fmt.Println("  Available MIDI inputs:")
-	for i, temp := range ins {
-		fmt.Printf("    in %2d: %s\n", i, temp)
-	}
-
-	fmt.Println("\n  Available MIDI outputs:")
-	for i, temp := range outs {
-		fmt.Printf("    out%2d: %s\n", i, temp)
-	}
-
+// MidiPortNames returns names of available MIDI inputs & outputs
+func MidiPortNames() ([]string, []string) {
+	return getMidiPortNames()
 }
 
 func SetMidi(inIdx int, outIdx int) error {
 	return setMidi(inIdx, outIdx)
 }
 
+// SetNetworkMidi connects to RTP-MIDI (AppleMIDI) session at address (host:port)
+func SetNetworkMidi(address string) error {
+	return setNetworkMidi(address)
+}
+
+// SetReplayMidi uses capture file as a fake device, answering to requests
+// with the recorded replies
+func SetReplayMidi(filename string) error {
+	return setReplayMidi(filename)
+}
+
 func createSysex(messageType byte, header []byte, data []byte) []byte {
 	var buf []byte
 	buf = append(header, convertBinaryDataToSysexData(data)...)
@@ -112,7 +110,7 @@ type response struct {
 	data     []byte
 }
 
-func getData(requestType byte, requestDataHeader []byte, requestData []byte) <-chan response {
+func getData(ctx context.Context, requestType byte, requestDataHeader []byte, requestData []byte) <-chan response {
 
 	var binData []byte
 	var err error
@@ -121,24 +119,37 @@ func getData(requestType byte, requestDataHeader []byte, requestData []byte) <-c
 
 	sysexMessage = createSysex(requestType, requestDataHeader, requestData)
 
-	if isDebug {
-		fmt.Printf("\nDEBUG: Sent SysEx:\n%s\n", hex.Dump(sysexMessage))
+	if logEnabled(LogDebug) {
+		logf(LogDebug, "Sent SysEx:\n%s", strings.TrimSuffix(hex.Dump(sysexMessage), "\n"))
+	}
+
+	replyChan := sendSysexAsync(ctx, sysexMessage)
+	r := <-replyChan
+
+	if r.err != nil {
+		ch <- response{r.err, 0, 0, nil}
+		return ch
 	}
 
-	replyChan := sendSysexAsync(sysexMessage)
-	reply := <-replyChan
+	reply := r.data
 
-	if reply == nil {
-		err = fmt.Errorf("ERROR: Communication not working!")
+	if len(reply) < 8 {
+		err = newError(ErrCommunication, nil, "Received wrong data!")
 		ch <- response{err, 0, 0, nil}
 		return ch
 	}
 
-	if isDebug {
-		fmt.Printf("\nDEBUG: Received SyEx:\n%s\n", hex.Dump(reply))
+	if logEnabled(LogDebug) {
+		logf(LogDebug, "Received SysEx:\n%s", strings.TrimSuffix(hex.Dump(reply), "\n"))
 	}
 
-	_, _, responseData := sysex.Response(reply)
+	_, responseType, responseData := sysex.Response(reply)
+
+	if text, isError := message.ErrorText[responseType]; isError {
+		err = newError(ErrDevice, nil, "Device reported: %s", text)
+		ch <- response{err, reply[5], reply[6], nil}
+		return ch
+	}
 
 	if len(responseData) > 10 {
 		responseDataHeaderSize := message.ResponseInfo[requestType].HeaderSize
@@ -146,7 +157,7 @@ func getData(requestType byte, requestDataHeader []byte, requestData []byte) <-c
 		binData = convertSysexDataToBinaryData(dataSection)
 
 		if binData == nil {
-			err = fmt.Errorf("ERROR: Received wrong data!")
+			err = newError(ErrCommunication, nil, "Received wrong data!")
 			ch <- response{err, reply[5], reply[6], nil}
 			return ch
 		}
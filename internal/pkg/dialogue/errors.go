@@ -0,0 +1,54 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error classes. Use errors.Is(err, ErrFile) etc. to check the class.
+var (
+	ErrArgument      = errors.New("invalid argument")
+	ErrFile          = errors.New("file error")
+	ErrPort          = errors.New("MIDI port error")
+	ErrCommunication = errors.New("communication error")
+	ErrDevice        = errors.New("device error")
+)
+
+// Error describes failed step with its class and underlying cause
+type Error struct {
+	Class error  // One of the error classes above
+	Op    string // Step that failed, including file or port name
+	Err   error  // Underlying cause (may be nil)
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Op
+	}
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) Is(target error) bool { return target == e.Class }
+
+func newError(class error, err error, format string, a ...interface{}) error {
+	return &Error{Class: class, Op: fmt.Sprintf(format, a...), Err: err}
+}
@@ -0,0 +1,106 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/midimessage/channel"
+)
+
+// Channel message types (status byte without channel)
+const (
+	EventNoteOff        byte = 0x80
+	EventNoteOn         byte = 0x90
+	EventPolyAftertouch byte = 0xA0
+	EventControlChange  byte = 0xB0
+	EventProgramChange  byte = 0xC0
+	EventAftertouch     byte = 0xD0
+	EventPitchbend      byte = 0xE0
+)
+
+// ChannelEvent is a channel message (note, CC, program change..) received from device
+type ChannelEvent struct {
+	Time    time.Time
+	Type    byte // One of EventXXX
+	Channel byte // 0-15
+	Data1   byte // Key, controller or program
+	Data2   byte // Velocity or value (0 if not used)
+	Message string
+}
+
+var subscribers struct {
+	sync.Mutex
+	list []chan ChannelEvent
+}
+
+// SubscribeChannelEvents returns channel for device's channel messages and
+// a function to unsubscribe. Events are dropped if the buffer is full.
+func SubscribeChannelEvents(buffer int) (<-chan ChannelEvent, func()) {
+	ch := make(chan ChannelEvent, buffer)
+
+	subscribers.Lock()
+	subscribers.list = append(subscribers.list, ch)
+	subscribers.Unlock()
+
+	unsubscribe := func() {
+		subscribers.Lock()
+		defer subscribers.Unlock()
+		for i, c := range subscribers.list {
+			if c == ch {
+				subscribers.list = append(subscribers.list[:i], subscribers.list[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+	return ch, unsubscribe
+}
+
+func publishChannelEvent(msg midi.Message) {
+	m, ok := msg.(channel.Message)
+	if !ok {
+		return
+	}
+	raw := m.Raw()
+	if len(raw) < 2 {
+		return
+	}
+
+	ev := ChannelEvent{
+		Time:    time.Now(),
+		Type:    raw[0] & 0xF0,
+		Channel: m.Channel(),
+		Data1:   raw[1],
+		Message: m.String(),
+	}
+	if len(raw) > 2 {
+		ev.Data2 = raw[2]
+	}
+
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	for _, ch := range subscribers.list {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -20,24 +20,17 @@ package dialogue
 import (
 	"archive/zip"
 	"bytes"
+	"sort"
 	"strconv"
 	"strings"
 
 	//"encoding/hex"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"path/filepath"
 	sysex "dialogue/internal/pkg/dialogue/sysex"
 )
 
-func checkError(err error) {
-	if err != nil {
-		fmt.Printf("error:%s", error.Error(err))
-		panic(err.Error())
-	}
-}
-
 func ParseModuleSlot(str string) (byte, byte, bool, error) {
 	
 	isModuleOnly := false
@@ -49,85 +42,125 @@ func ParseModuleSlot(str string) (byte, byte, bool, error) {
 
 	res := strings.Split(str, "/")
 	if res == nil || len(res) != 2 || sysex.ModuleID(res[0]) == 0 {
-		return 0, 0, isModuleOnly, fmt.Errorf("Wrong  module/slot option format!")
+		return 0, 0, isModuleOnly, newError(ErrArgument, nil, "Wrong module/slot option format '%s'!", str)
 	}
 	moduleSlot, err := strconv.Atoi(res[1])
-	return sysex.ModuleID(res[0]), byte(moduleSlot), isModuleOnly, err
-}
-
-func convertBinaryDataToSysexData(data []byte) []byte {
-	var outBuffer []byte
-	datalen := len(data)
-	for i := 0; i < datalen/7; i++ {
-		outBuffer = append(outBuffer, binDataToSysexData(data[i*7:i*7+7])...)
-	}
-	if datalen%7 != 0 {
-		outBuffer = append(outBuffer, binDataToSysexData(data[len(data)-(datalen%7):])...)
+	if err != nil {
+		return 0, 0, isModuleOnly, newError(ErrArgument, err, "Wrong slot number in '%s'", str)
 	}
-	return outBuffer
+	return sysex.ModuleID(res[0]), byte(moduleSlot), isModuleOnly, nil
 }
 
-func binDataToSysexData(data []byte) []byte {
-	var outBuffer []byte
-	outBuffer = make([]byte, len(data)+1)
+// Bytes encoded or decoded between progress reports
+const progressCodecStep = 1024
 
-	for i := 0; i < len(data); i++ {
-		outBuffer[0] += (data[i] & 0b10000000) >> (7 - i)
-		outBuffer[i+1] = data[i] & 0b01111111
+// convertBinaryDataToSysexData packs data to 7-bit SysEx data in steps,
+// reporting encode progress
+func convertBinaryDataToSysexData(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
 	}
-	return outBuffer
-}
-
-func sysexDataToBinData(data []byte) []byte {
-	var outBuffer []byte
-	outBuffer = make([]byte, len(data)-1)
-
-	for i := 0; i < len(data)-1; i++ {
-		outBuffer[i] = data[i+1] + ((data[0] << (len(data) - 1 - i)) & 0b10000000)
+	out := bytes.NewBuffer(make([]byte, 0, sysex.EncodedLen(len(data))))
+	enc := sysex.NewEncoder(out)
+	reportProgress(PhaseEncode, 0, len(data))
+	for done := 0; done < len(data); {
+		end := done + progressCodecStep
+		if end > len(data) {
+			end = len(data)
+		}
+		n, _ := enc.Write(data[done:end])
+		done += n
+		reportProgress(PhaseEncode, done, len(data))
 	}
-	return outBuffer
+	enc.Close()
+	return out.Bytes()
 }
 
+// convertSysexDataToBinaryData unpacks 7-bit SysEx data in steps,
+// reporting decode progress
 func convertSysexDataToBinaryData(sysexData []byte) []byte {
-	var outBuffer []byte
-	datalen := len(sysexData)
-	for i := 0; i < datalen/8; i++ {
-		outBuffer = append(outBuffer, sysexDataToBinData(sysexData[i*8:i*8+8])...)
+	if len(sysexData) == 0 {
+		return nil
 	}
-	if datalen%8 != 0 {
-		outBuffer = append(outBuffer, sysexDataToBinData(sysexData[len(sysexData)-(datalen%8):])...)
+	outBuffer := make([]byte, sysex.DecodedLen(len(sysexData)))
+	dec := sysex.NewDecoder(bytes.NewReader(sysexData))
+	reportProgress(PhaseDecode, 0, len(outBuffer))
+	for done := 0; done < len(outBuffer); {
+		end := done + progressCodecStep
+		if end > len(outBuffer) {
+			end = len(outBuffer)
+		}
+		n, err := io.ReadFull(dec, outBuffer[done:end])
+		done += n
+		reportProgress(PhaseDecode, done, len(outBuffer))
+		if err != nil {
+			return outBuffer[:done]
+		}
 	}
 	return outBuffer
 }
 
-func getDataFromZipFile(extension string, zipFile string) []byte {
+func getDataFromZipFile(extension string, zipFile string) ([]byte, error) {
 	var buf []byte
 
 	// Open a zip archive for reading.
 	r, err := zip.OpenReader(zipFile)
-	checkError(err)
+	if err != nil {
+		return nil, newError(ErrFile, err, "Cannot open '%s'", zipFile)
+	}
 	defer r.Close()
 
 	for _, f := range r.File {
-		
-		rc, err := f.Open()
-		checkError(err)
 
 		if filepath.Ext(f.Name) == extension {
-		
-			buf = make([]byte, f.UncompressedSize)
-			_, err := rc.Read(buf)
 
+			rc, err := f.Open()
 			if err != nil {
-				if err != io.EOF {
-					checkError(err)
-				}
+				return nil, newError(ErrFile, err, "Cannot read '%s' in '%s'", f.Name, zipFile)
+			}
+
+			buf = make([]byte, f.UncompressedSize64)
+			_, err = io.ReadFull(rc, buf)
+			rc.Close()
+
+			if err != nil {
+				return nil, newError(ErrFile, err, "Cannot read '%s' in '%s'", f.Name, zipFile)
 			}
 			break
 		}
+	}
+	return buf, nil
+}
+
+// getAllDataFromZipFile returns contents of all files with extension (all
+// files if extension is empty) by name
+func getAllDataFromZipFile(extension string, zipFile string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	r, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return nil, newError(ErrFile, err, "Cannot open '%s'", zipFile)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if extension != "" && filepath.Ext(f.Name) != extension {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, newError(ErrFile, err, "Cannot read '%s' in '%s'", f.Name, zipFile)
+		}
+		buf, err := ioutil.ReadAll(rc)
 		rc.Close()
+
+		if err != nil {
+			return nil, newError(ErrFile, err, "Cannot read '%s' in '%s'", f.Name, zipFile)
+		}
+		files[f.Name] = buf
 	}
-	return buf
+	return files, nil
 }
 
 func createZipFile(outname string, fileList map[string][]byte) error {
@@ -137,25 +170,36 @@ func createZipFile(outname string, fileList map[string][]byte) error {
 
 	zipWriter := zip.NewWriter(buf)
 
-	for name, content := range fileList {
+	// Files in name order (FileInformation.xml, Prog_000.., ..)
+	var names []string
+	for name := range fileList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		content := fileList[name]
 		zipFile, err := zipWriter.Create(name)
 		if err != nil {
-			return err
+			return newError(ErrFile, err, "Cannot add '%s' to '%s'", name, outname)
 		}
 		_, err = zipFile.Write(content)
 		if err != nil {
-			return err
+			return newError(ErrFile, err, "Cannot add '%s' to '%s'", name, outname)
 		}
 	}
 
 	err := zipWriter.Close()
 	if err != nil {
-		return err
+		return newError(ErrFile, err, "Cannot create '%s'", outname)
 	}
 
 	//write the zipped data to the disk
 	err = ioutil.WriteFile(outname, buf.Bytes(), 0777)
-	return err
+	if err != nil {
+		return newError(ErrFile, err, "Cannot write '%s'", outname)
+	}
+	return nil
 }
 
 
@@ -0,0 +1,121 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LogLevel of a log message. Messages up to the set level are logged.
+type LogLevel int
+
+// Log levels in order of verbosity
+const (
+	LogError LogLevel = iota
+	LogWarning
+	LogInfo
+	LogDebug
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogError:
+		return "error"
+	case LogWarning:
+		return "warning"
+	case LogInfo:
+		return "info"
+	case LogDebug:
+		return "debug"
+	default:
+		return "unknown"
+	}
+}
+
+// Logger receives log messages, possibly from MIDI driver's goroutine
+type Logger interface {
+	Log(level LogLevel, message string)
+}
+
+// LoggerFunc adapts a function to Logger
+type LoggerFunc func(level LogLevel, message string)
+
+// Log calls f(level, message)
+func (f LoggerFunc) Log(level LogLevel, message string) { f(level, message) }
+
+// NewLogger returns Logger writing one message per line to w. Info messages
+// are written as is, others prefixed with the level.
+func NewLogger(w io.Writer) Logger {
+	var mu sync.Mutex
+	return LoggerFunc(func(level LogLevel, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if level == LogInfo {
+			fmt.Fprintln(w, message)
+			return
+		}
+		fmt.Fprintf(w, "%s: %s\n", strings.ToUpper(level.String()), message)
+	})
+}
+
+var logging = struct {
+	sync.Mutex
+	logger Logger
+	level  LogLevel
+}{
+	logger: NewLogger(os.Stderr),
+	level:  LogInfo,
+}
+
+// SetLogger sets the destination of log messages (nil disables logging)
+func SetLogger(l Logger) {
+	logging.Lock()
+	logging.logger = l
+	logging.Unlock()
+}
+
+// SetLogLevel sets the most verbose level logged (default LogInfo)
+func SetLogLevel(level LogLevel) {
+	logging.Lock()
+	logging.level = level
+	logging.Unlock()
+}
+
+// EnableDebugging enables debug messages (incl. dumps of sent & received SysEx)
+func EnableDebugging() { SetLogLevel(LogDebug) }
+
+func logEnabled(level LogLevel) bool {
+	logging.Lock()
+	defer logging.Unlock()
+	return logging.logger != nil && level <= logging.level
+}
+
+func logf(level LogLevel, format string, a ...interface{}) {
+	logging.Lock()
+	l := logging.logger
+	enabled := level <= logging.level
+	logging.Unlock()
+
+	if l != nil && enabled {
+		l.Log(level, fmt.Sprintf(format, a...))
+	}
+}
@@ -18,7 +18,7 @@
 package dialogue
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"gitlab.com/gomidi/midi"
@@ -26,6 +26,8 @@ import (
 	"gitlab.com/gomidi/midi/reader"
 	"gitlab.com/gomidi/midi/writer"
 	driver "gitlab.com/gomidi/rtmididrv"
+
+	rtpmidi "dialogue/internal/pkg/dialogue/rtpmidi"
 )
 
 type midiConnection struct {
@@ -36,6 +38,10 @@ type midiConnection struct {
 	in   midi.In
 	out  midi.Out
 	ch   chan []byte
+	net  *rtpmidi.Session
+
+	// Out port passes SysEx written in parts (needed for pacing)
+	partialSysex bool
 }
 
 var midiConn midiConnection
@@ -43,16 +49,23 @@ var midiConn midiConnection
 func initializeMidi() error {
 	var err error
 	midiConn.drv, err = driver.New()
+	if err != nil {
+		return newError(ErrPort, err, "Cannot initialize MIDI driver")
+	}
 
 	midiConn.ins, err = midiConn.drv.Ins()
-	checkError(err)
+	if err != nil {
+		return newError(ErrPort, err, "Cannot list MIDI inputs")
+	}
 
 	midiConn.outs, err = midiConn.drv.Outs()
-	checkError(err)
+	if err != nil {
+		return newError(ErrPort, err, "Cannot list MIDI outputs")
+	}
 
-	midiConn.ch = make(chan []byte)
+	midiConn.ch = make(chan []byte, 1)
 
-	return err
+	return nil
 }
 
 func getMidiPortNames() ([]string, []string) {
@@ -75,6 +88,9 @@ func closeMidi() {
 	if midiConn.out != nil {
 		midiConn.out.Close()
 	}
+	if midiConn.net != nil {
+		midiConn.net.Close()
+	}
 	if midiConn.drv != nil {
 		midiConn.drv.Close()
 	}
@@ -83,17 +99,47 @@ func closeMidi() {
 func setMidi(inIdx int, outIdx int) error {
 
 	if inIdx < 0 || inIdx > len(midiConn.ins)-1 {
-		return fmt.Errorf("In port is out of range!")
+		return newError(ErrPort, nil, "In port %d is out of range!", inIdx)
 	}
 
 	if outIdx < 0 || outIdx > len(midiConn.outs)-1 {
-		return fmt.Errorf("Out port is out of range!")
+		return newError(ErrPort, nil, "Out port %d is out of range!", outIdx)
 	}
 
 	midiConn.in, midiConn.out = midiConn.ins[inIdx], midiConn.outs[outIdx]
+	midiConn.partialSysex = rtmidiPartialSysex()
+	if err := checkPacing(); err != nil {
+		return err
+	}
+
+	return listenMidi()
+}
 
-	checkError(midiConn.in.Open())
-	checkError(midiConn.out.Open())
+// Network (RTP-MIDI) session to device at address (host:port)
+func setNetworkMidi(address string) error {
+	var err error
+
+	midiConn.net, err = rtpmidi.Dial(address, "dialogue")
+	if err != nil {
+		return newError(ErrPort, err, "Cannot connect to RTP-MIDI session '%s'", address)
+	}
+
+	midiConn.in, midiConn.out = midiConn.net.In(), midiConn.net.Out()
+	midiConn.partialSysex = true
+	if midiConn.ch == nil {
+		midiConn.ch = make(chan []byte, 1)
+	}
+
+	return listenMidi()
+}
+
+func listenMidi() error {
+	if err := midiConn.in.Open(); err != nil {
+		return newError(ErrPort, err, "Cannot open MIDI input '%s'", midiConn.in)
+	}
+	if err := midiConn.out.Open(); err != nil {
+		return newError(ErrPort, err, "Cannot open MIDI output '%s'", midiConn.out)
+	}
 
 	midiConn.wr = writer.New(midiConn.out)
 
@@ -101,59 +147,116 @@ func setMidi(inIdx int, outIdx int) error {
 		reader.NoLogger(),
 		reader.IgnoreMIDIClock(),
 		reader.SysEx(func(pos *reader.Position, data []byte) {
-			midiConn.ch <- sysex.SysEx(data).Raw()
+			raw := sysex.SysEx(data).Raw()
+			captureSysex(DirectionReceived, raw)
+
+			// Don't block the driver if nobody is waiting (e.g. cancelled request)
+			select {
+			case midiConn.ch <- raw:
+			default:
+			}
+		}),
+		// channel messages (notes, CC, program change..) to subscribers
+		reader.Each(func(pos *reader.Position, msg midi.Message) {
+			publishChannelEvent(msg)
 		}),
-		// write every message to the out port
-		//reader.Each(func(pos *reader.Position, msg midi.Message) {
-		//	fmt.Printf("got %s\n", msg)
-		//}),
 	)
 
-	// listen for MIDI
-	err := rd.ListenTo(midiConn.in)
-	checkError(err)
+	// listen for MIDI (long SysEx may arrive in several packets)
+	err := rd.ListenTo(newReassemblingIn(midiConn.in))
+	if err != nil {
+		return newError(ErrPort, err, "Cannot listen MIDI input '%s'", midiConn.in)
+	}
 
-	return err
+	return nil
 }
 
-func sendSysexAsync(sysexData []byte) <-chan []byte {
-	replyChan := make(chan []byte, 1)
-	if midiConn.wr != nil {
-		err := writer.SysEx(midiConn.wr, sysexData)
-		checkError(err)
+type sysexReply struct {
+	data []byte
+	err  error
+}
+
+func sendSysexAsync(ctx context.Context, sysexData []byte) <-chan sysexReply {
+	replyChan := make(chan sysexReply, 1)
+
+	// Drop stale reply of an earlier (cancelled or timed out) request
+	select {
+	case <-midiConn.ch:
+	default:
+	}
+
+	// Nothing more is sent after cancel
+	if err := ctx.Err(); err != nil {
+		replyChan <- sysexReply{nil, err}
+		return replyChan
+	}
+
+	var err error
+
+	captureSysex(DirectionSent, sysexData)
+
+	if midiConn.wr != nil && pacing.enabled() {
+		err = writePaced(ctx, sysexData)
+	} else if midiConn.wr != nil {
+		logEstimate(len(sysexData))
+		reportProgress(PhaseSend, 0, len(sysexData))
+		err = writer.SysEx(midiConn.wr, sysexData)
+		reportProgress(PhaseSend, len(sysexData), len(sysexData))
 	} else {
-		fmt.Printf("Out port is not writeable!")
-		replyChan <- nil
+		err = newError(ErrPort, nil, "Out port is not writeable!")
+	}
+
+	if err != nil && err == ctx.Err() {
+		replyChan <- sysexReply{nil, err}
+		return replyChan
+	}
+	if err != nil {
+		replyChan <- sysexReply{nil, newError(ErrPort, err, "Cannot send SysEx to '%s'", midiConn.out)}
 		return replyChan
 	}
 
+	reportProgress(PhaseReceive, 0, 0)
+
 	select {
 	case reply := <-midiConn.ch:
-		replyChan <- reply
-		return replyChan
+		reportProgress(PhaseReceive, len(reply), len(reply))
+		replyChan <- sysexReply{reply, nil}
+	case <-ctx.Done():
+		replyChan <- sysexReply{nil, ctx.Err()}
 	case <-time.After(15 * time.Second):
-		fmt.Printf("ERROR: Timeout!")
-		replyChan <- nil
-		return replyChan
+		replyChan <- sysexReply{nil, newError(ErrCommunication, nil, "Timeout! No reply from device")}
 	}
+	return replyChan
 }
 
 func sendControlChange(channel byte, controller byte, value byte) error {
+	if midiConn.wr == nil {
+		return newError(ErrPort, nil, "Out port is not writeable!")
+	}
 	midiConn.wr.SetChannel(channel)
 	return writer.ControlChange(midiConn.wr, controller, value)
 }
 
 func sendProgramChange(channel byte, program byte) error {
+	if midiConn.wr == nil {
+		return newError(ErrPort, nil, "Out port is not writeable!")
+	}
 	midiConn.wr.SetChannel(channel)
 	return writer.ProgramChange(midiConn.wr, program)
 }
 
 func sendNoteOn(channel byte, key byte, volume byte) error {
+	if midiConn.wr == nil {
+		return newError(ErrPort, nil, "Out port is not writeable!")
+	}
 	midiConn.wr.SetChannel(channel)
 	return writer.NoteOn(midiConn.wr, key, volume)
 }
 
 func sendNoteOff(channel byte, key byte) error {
+	if midiConn.wr == nil {
+		return newError(ErrPort, nil, "Out port is not writeable!")
+	}
 	midiConn.wr.SetChannel(channel)
 	return writer.NoteOff(midiConn.wr, key)
 }
@@ -0,0 +1,130 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// Pacing defines how SysEx messages are split and throttled when sent.
+// Needed with 5-pin DIN and cheap USB-MIDI interfaces that drop bytes.
+type Pacing struct {
+	ChunkSize      int           // Bytes per write (0 = whole message at once)
+	Delay          time.Duration // Delay between chunks
+	BytesPerSecond int           // Target rate, used if Delay is not set
+}
+
+// Default chunk size when only target rate is given
+const defaultPacingChunkSize = 64
+
+// MIDI DIN line rate: 31250 baud, 10 bits per byte
+const midiLineBytesPerSecond = 3125
+
+// Unpaced messages shorter than this are sent without transfer time estimate
+const estimateMinSize = 1024
+
+var pacing Pacing
+
+// SetPacing enables paced SysEx transmission (zero value disables)
+func SetPacing(p Pacing) {
+	if p.BytesPerSecond > 0 && p.ChunkSize <= 0 {
+		p.ChunkSize = defaultPacingChunkSize
+	}
+	if p.BytesPerSecond > 0 && p.Delay == 0 {
+		p.Delay = time.Duration(p.ChunkSize) * time.Second / time.Duration(p.BytesPerSecond)
+	}
+	pacing = p
+}
+
+func (p Pacing) enabled() bool {
+	return p.ChunkSize > 0
+}
+
+// estimate returns expected transfer time of size bytes. Delays are waited
+// after each chunk has been written, so they add to the line time.
+func (p Pacing) estimate(size int) time.Duration {
+	lineTime := time.Duration(size) * time.Second / midiLineBytesPerSecond
+	if !p.enabled() {
+		return lineTime
+	}
+	chunks := (size + p.ChunkSize - 1) / p.ChunkSize
+	return lineTime + time.Duration(chunks-1)*p.Delay
+}
+
+// rtmidiPartialSysex tells if RtMidi passes SysEx written in parts. CoreMIDI
+// (macOS) and WinMM (Windows) backends drop parts not starting with 0xF0
+// with only a warning; ALSA sends the bytes as they are.
+func rtmidiPartialSysex() bool {
+	return runtime.GOOS != "darwin" && runtime.GOOS != "windows"
+}
+
+// checkPacing returns error if pacing is enabled but the out port cannot
+// send SysEx in parts
+func checkPacing() error {
+	if pacing.enabled() && midiConn.out != nil && !midiConn.partialSysex {
+		return newError(ErrArgument, nil, "Paced sending (chunk size / rate) is not supported by the MIDI driver on %s", runtime.GOOS)
+	}
+	return nil
+}
+
+// logEstimate prints expected transfer time of unpaced message of size bytes
+func logEstimate(size int) {
+	if size >= estimateMinSize {
+		logf(LogInfo, "Sending %d bytes (estimated transfer time %.1fs)...", size, pacing.estimate(size).Seconds())
+	}
+}
+
+// writePaced writes raw SysEx message in chunks with delay in between.
+// Cancelling ctx stops sending after the chunk in progress.
+func writePaced(ctx context.Context, sysexData []byte) error {
+	if err := checkPacing(); err != nil {
+		return err
+	}
+	if len(sysexData) > pacing.ChunkSize {
+		logf(LogInfo, "Sending %d bytes in %d byte chunks (estimated transfer time %.1fs)...",
+			len(sysexData),
+			pacing.ChunkSize,
+			pacing.estimate(len(sysexData)).Seconds(),
+		)
+	}
+
+	reportProgress(PhaseSend, 0, len(sysexData))
+
+	for start := 0; start < len(sysexData); start += pacing.ChunkSize {
+		if start > 0 {
+			select {
+			case <-ctx.Done():
+				// End the unfinished SysEx so device doesn't wait for the rest
+				midiConn.out.Write([]byte{0xF7})
+				return ctx.Err()
+			case <-time.After(pacing.Delay):
+			}
+		}
+		end := start + pacing.ChunkSize
+		if end > len(sysexData) {
+			end = len(sysexData)
+		}
+		if _, err := midiConn.out.Write(sysexData[start:end]); err != nil {
+			return err
+		}
+		reportProgress(PhaseSend, end, len(sysexData))
+	}
+	return nil
+}
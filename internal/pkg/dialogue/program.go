@@ -19,9 +19,15 @@
 package dialogue
 
 import (
-	"fmt"
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	prologue "dialogue/internal/pkg/dialogue/prologue"
 	sysex "dialogue/internal/pkg/dialogue/sysex"
 	sysexMessageType "dialogue/internal/pkg/dialogue/sysex/message"
 )
@@ -36,34 +42,41 @@ func (p ProgramRange) has(programNumber int) bool {
 }
 
 // Prologue way of selecting program..
-func SelectProgram(number int) error {
+func SelectProgram(ctx context.Context, number int) error {
 	if number < dlg.getDeviceSpecificInfo().programRange.min || number > dlg.getDeviceSpecificInfo().programRange.max {
-		return fmt.Errorf("ERROR: Program number out of range!")
+		return newError(ErrArgument, nil, "Program number %d out of range!", number)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 	number--
 	bankMsb := byte(0)
 	bankLsb := byte(number / 100)
 	num := byte(number % 100)
 
-	sendNoteOn(dlg.getDeviceSpecificInfo().deviceID-1, 1, 1)
+	if err := sendNoteOn(dlg.getDeviceSpecificInfo().deviceID-1, 1, 1); err != nil {
+		return err
+	}
 	//time.Sleep(2 * time.Millisecond)
 	sendNoteOff(dlg.getDeviceSpecificInfo().deviceID-1, 1)
 	sendControlChange(dlg.getDeviceSpecificInfo().deviceID-1, 0x78, 0)
 	time.Sleep(1 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	sendControlChange(dlg.getDeviceSpecificInfo().deviceID-1, 0x00, bankMsb)
 	sendControlChange(dlg.getDeviceSpecificInfo().deviceID-1, 0x20, bankLsb)
-	sendProgramChange(dlg.getDeviceSpecificInfo().deviceID-1, num)
+	err := sendProgramChange(dlg.getDeviceSpecificInfo().deviceID-1, num)
 	time.Sleep(1 * time.Millisecond)
-	return nil
+	return err
 }
 
-func SetProgram(programNumber int, filename string) <-chan error {
+// WriteProgram sends program data to program number. Edit buffer is used if number is out of range.
+func WriteProgram(ctx context.Context, programNumber int, data []byte) error {
 	var msgType byte
 	var header []byte
 
-	data := getDataFromZipFile(dlg.getDeviceSpecificInfo().programDataFileExtension, filename)
-
 	if dlg.getDeviceSpecificInfo().programRange.has(programNumber) {
 		msgType = sysexMessageType.ProgramDataDump
 		header = sysex.ProgramNumber(programNumber)
@@ -71,15 +84,12 @@ func SetProgram(programNumber int, filename string) <-chan error {
 		msgType = sysexMessageType.CurrentProgramDataDump
 	}
 
-	resp := <-getData(msgType, header, data)
-
-	errChan := make(chan error, 1)
-	errChan <- resp.err
-
-	return errChan
+	resp := <-getData(ctx, msgType, header, data)
+	return resp.err
 }
 
-func GetProgram(programNumber int, filename string) <-chan error {
+// ReadProgram returns program data of program number. Edit buffer is used if number is out of range.
+func ReadProgram(ctx context.Context, programNumber int) ([]byte, error) {
 	var msgType byte
 	var header []byte
 
@@ -90,34 +100,376 @@ func GetProgram(programNumber int, filename string) <-chan error {
 		msgType = sysexMessageType.CurrentProgramDataDumpRequest
 	}
 
-	resp := <-getData(msgType, header, nil)
+	resp := <-getData(ctx, msgType, header, nil)
 
-	errChan := make(chan error, 1)
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	if len(resp.data) == 0 {
+		return nil, newError(ErrCommunication, nil, "Received wrong data!")
+	}
+	return resp.data, nil
+}
 
-	err := saveProgramDataToFile(resp.data, filename)
+// LoadProgramFile returns program data from program file (*.XXXprog), or
+// the first program of library file
+func LoadProgramFile(filename string) ([]byte, error) {
+	programs, err := LoadPrograms(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(programs) == 0 {
+		return nil, newError(ErrFile, nil, "No program data in '%s'!", filename)
+	}
+	return programs[0], nil
+}
 
+// PickProgram returns program of program or library file by number in file
+// (1 = first) or by name (case insensitive)
+func PickProgram(filename string, pick string) ([]byte, error) {
+	programs, err := LoadPrograms(filename)
 	if err != nil {
-		err := fmt.Errorf("ERROR: Wrong data!")
-		errChan <- err
-		return errChan
+		return nil, err
+	}
+
+	if n, err := strconv.Atoi(pick); err == nil {
+		if n < 1 || n > len(programs) {
+			return nil, newError(ErrArgument, nil, "'%s' has %d programs, no program %d", filename, len(programs), n)
+		}
+		return programs[n-1], nil
 	}
 
-	errChan <- resp.err
-	return errChan
+	for _, data := range programs {
+		if p, err := prologue.ToProgram(data); err == nil && strings.EqualFold(p.Name, pick) {
+			return data, nil
+		}
+	}
+	return nil, newError(ErrArgument, nil, "No program '%s' in '%s'", pick, filename)
+}
+
+// Extension of program information in program package
+const programInfoFileExtension = ".prog_info"
+
+// programList returns the programs listed in FileInformation.xml of package
+// contents, or nil if there is no list or it does not match the program data
+// files of the package
+func programList(files map[string][]byte) []ProgramData {
+	data, ok := files[fileInformationFileName]
+	if !ok {
+		return nil
+	}
+	korg, err := parseFileInformationXML(data)
+	if err != nil {
+		return nil
+	}
+
+	extension := dlg.getDeviceSpecificInfo().programDataFileExtension
+	count := 0
+	for name := range files {
+		if filepath.Ext(name) == extension {
+			count++
+		}
+	}
+	listed := map[string]bool{}
+	for _, p := range korg.Contents.ProgramData {
+		if _, ok := files[p.ProgramBinary]; !ok || filepath.Ext(p.ProgramBinary) != extension || listed[p.ProgramBinary] {
+			return nil
+		}
+		listed[p.ProgramBinary] = true
+	}
+	if len(listed) != count {
+		return nil
+	}
+	return korg.Contents.ProgramData
 }
 
-func saveProgramDataToFile(data []byte, filename string) error {
-	deviceName := dlg.getDeviceSpecificInfo().deviceName
-	fileInfoXML := createFileInformationXML(deviceName)
+// programEntries returns names of program data files of package contents
+// in file order: as listed in FileInformation.xml, or by name if the
+// package has no usable list
+func programEntries(files map[string][]byte) []string {
+	var names []string
+	if list := programList(files); list != nil {
+		for _, p := range list {
+			names = append(names, p.ProgramBinary)
+		}
+		return names
+	}
 
-	programInfoXML := createProgramInfoXML(dlg.getDeviceSpecificInfo().programInfoName, "", "")
+	extension := dlg.getDeviceSpecificInfo().programDataFileExtension
+	for name := range files {
+		if filepath.Ext(name) == extension {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// infoEntry returns name of program information file of program data file,
+// as listed in FileInformation.xml or named after the program data file
+func infoEntry(files map[string][]byte, name string) string {
+	for _, p := range programList(files) {
+		if p.ProgramBinary == name && p.Information != "" {
+			return p.Information
+		}
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + programInfoFileExtension
+}
+
+// LoadPrograms returns all programs of program or library file
+// (*.XXXprog, *.XXXlib) in file order
+func LoadPrograms(filename string) ([][]byte, error) {
+	files, err := getAllDataFromZipFile("", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var programs [][]byte
+	for _, name := range programEntries(files) {
+		programs = append(programs, files[name])
+	}
+	return programs, nil
+}
+
+// LoadProgramInfo returns metadata of all programs of program or library
+// file in file order. Metadata is empty for programs without it.
+func LoadProgramInfo(filename string) ([]ProgramInfo, error) {
+	files, err := getAllDataFromZipFile("", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []ProgramInfo
+	for _, name := range programEntries(files) {
+		var info ProgramInfo
+		if data, ok := files[infoEntry(files, name)]; ok {
+			if info, err = parseProgramInfoXML(data); err != nil {
+				return nil, newError(ErrFile, err, "Cannot parse '%s' in '%s'", infoEntry(files, name), filename)
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SaveProgramFile writes program data to program file (*.XXXprog)
+func SaveProgramFile(filename string, data []byte) error {
+	return SaveProgramFileWithInfo(filename, data, ProgramInfo{})
+}
+
+// SaveProgramFileWithInfo writes program data and its metadata to program
+// file (*.XXXprog)
+func SaveProgramFileWithInfo(filename string, data []byte, info ProgramInfo) error {
+	return SaveProgramLibrary(filename, [][]byte{data}, []ProgramInfo{info})
+}
+
+// SaveProgramLibrary writes programs and their metadata (may be shorter than
+// programs) to library file (*.XXXlib)
+func SaveProgramLibrary(filename string, programs [][]byte, infos []ProgramInfo) error {
+	info := dlg.getDeviceSpecificInfo()
 
 	files := map[string][]byte{
-		"FileInformation.xml": []byte(fileInfoXML),
-		"Prog_000.prog_info":  []byte(programInfoXML),
-		"Prog_000.prog_bin":   data,
+		fileInformationFileName: []byte(createFileInformationXML(info.deviceName, len(programs), info.programDataFileExtension)),
+	}
+	for i, data := range programs {
+		var programInfo ProgramInfo
+		if i < len(infos) {
+			programInfo = infos[i]
+		}
+		files[programEntryName(i, programInfoFileExtension)] = []byte(createProgramInfoXML(info.programInfoName, programInfo.Programmer, programInfo.Comment))
+		files[programEntryName(i, info.programDataFileExtension)] = data
 	}
 
 	err := createZipFile(filename, files)
 	return err
-}
\ No newline at end of file
+}
+
+// UpdateProgramFile replaces programs of program or library file in file
+// order. Other contents of the file (e.g. program info) are kept.
+func UpdateProgramFile(filename string, programs [][]byte) error {
+	files, err := getAllDataFromZipFile("", filename)
+	if err != nil {
+		return err
+	}
+
+	names := programEntries(files)
+	if len(names) != len(programs) {
+		return newError(ErrArgument, nil, "'%s' has %d programs, got %d", filename, len(names), len(programs))
+	}
+
+	for i, name := range names {
+		files[name] = programs[i]
+	}
+	return createZipFile(filename, files)
+}
+
+// UpdateProgramInfo replaces metadata of program (0 = first) in program or
+// library file
+func UpdateProgramInfo(filename string, index int, info ProgramInfo) error {
+	files, err := getAllDataFromZipFile("", filename)
+	if err != nil {
+		return err
+	}
+
+	names := programEntries(files)
+	if index < 0 || index >= len(names) {
+		return newError(ErrArgument, nil, "'%s' has %d programs, no program %d", filename, len(names), index+1)
+	}
+
+	programInfoXML := createProgramInfoXML(dlg.getDeviceSpecificInfo().programInfoName, info.Programmer, info.Comment)
+	files[infoEntry(files, names[index])] = []byte(programInfoXML)
+	return createZipFile(filename, files)
+}
+
+// DecodeProgram returns typed model of program data
+func DecodeProgram(data []byte) (prologue.Program, error) {
+	p, err := prologue.ToProgram(data)
+	if err != nil {
+		return p, newError(ErrArgument, err, "Cannot decode program")
+	}
+	return p, nil
+}
+
+// ExportProgram writes program data and its metadata in text form (YAML or JSON)
+func ExportProgram(w io.Writer, data []byte, info ProgramInfo, format string) error {
+	fields := map[string]string{"programmer": info.Programmer, "comment": info.Comment}
+	if err := prologue.ExportInfo(w, data, fields, format); err != nil {
+		return newError(ErrArgument, err, "Cannot export program")
+	}
+	return nil
+}
+
+// ImportProgram returns program data and metadata of program in text form
+func ImportProgram(r io.Reader) ([]byte, ProgramInfo, error) {
+	var info ProgramInfo
+	data, fields, err := prologue.ImportInfo(r)
+	if err != nil {
+		return nil, info, newError(ErrFile, err, "Cannot import program")
+	}
+	for k, v := range fields {
+		switch k {
+		case "programmer":
+			info.Programmer = v
+		case "comment":
+			info.Comment = v
+		default:
+			return nil, info, newError(ErrFile, nil, "Cannot import program: unknown info '%s'", k)
+		}
+	}
+	return data, info, nil
+}
+
+// DiffPrograms returns differing parameters of two programs
+func DiffPrograms(a []byte, b []byte) ([]prologue.Difference, error) {
+	diffs, err := prologue.Diff(a, b)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot compare programs")
+	}
+	return diffs, nil
+}
+
+// RenameProgram returns copy of program data with new name
+func RenameProgram(data []byte, name string) ([]byte, error) {
+	if _, err := prologue.ToProgram(data); err != nil {
+		return nil, newError(ErrArgument, err, "Cannot rename program")
+	}
+	if err := prologue.CheckName(name); err != nil {
+		return nil, newError(ErrArgument, err, "Cannot rename program")
+	}
+	renamed := append([]byte(nil), data...)
+	param, _ := prologue.FindParam("name")
+	if err := param.SetText(renamed, name); err != nil {
+		return nil, newError(ErrArgument, err, "Cannot rename program")
+	}
+	return renamed, nil
+}
+
+// ParseQuery parses program search query (see prologue.Query)
+func ParseQuery(text string) (prologue.Query, error) {
+	q, err := prologue.ParseQuery(text)
+	if err != nil {
+		return q, newError(ErrArgument, err, "Invalid query '%s'", text)
+	}
+	return q, nil
+}
+
+// MorphPrograms returns blend of programs a and b at position t (0~1)
+func MorphPrograms(a []byte, b []byte, t float64, threshold float64) ([]byte, error) {
+	data, err := prologue.Morph(a, b, t, threshold)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot morph programs")
+	}
+	return data, nil
+}
+
+// CopyTimbre returns copy of program with timbre copied over the other one
+func CopyTimbre(data []byte, from prologue.TimbreID, to prologue.TimbreID) ([]byte, error) {
+	out, err := prologue.CopyTimbre(data, from, to)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot copy timbre")
+	}
+	return out, nil
+}
+
+// SwapTimbres returns copy of program with main and sub timbres swapped
+func SwapTimbres(data []byte) ([]byte, error) {
+	out, err := prologue.SwapTimbres(data)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot swap timbres")
+	}
+	return out, nil
+}
+
+// LayerTimbres returns program a with timbre of b as sub timbre (layered)
+func LayerTimbres(a []byte, b []byte, t prologue.TimbreID) ([]byte, error) {
+	out, err := prologue.LayerTimbres(a, b, t)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot layer timbres")
+	}
+	return out, nil
+}
+
+// ExtractTimbre returns program with one timbre as main timbre and sub turned off
+func ExtractTimbre(data []byte, t prologue.TimbreID) ([]byte, error) {
+	out, err := prologue.ExtractTimbre(data, t)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot extract timbre")
+	}
+	return out, nil
+}
+
+// LintProgram returns problems in program name and parameter values
+func LintProgram(data []byte) ([]prologue.Issue, error) {
+	issues, err := prologue.Lint(data)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot check program")
+	}
+	return issues, nil
+}
+
+// SanitizeProgram returns copy of program with values clamped to their ranges
+func SanitizeProgram(data []byte) ([]byte, error) {
+	out, err := prologue.Sanitize(data)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot sanitize program")
+	}
+	return out, nil
+}
+
+// ProgramSlotRefs returns user unit slots used by program
+func ProgramSlotRefs(data []byte) ([]prologue.SlotRef, error) {
+	refs, err := prologue.UserSlotRefs(data)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot decode program")
+	}
+	return refs, nil
+}
+
+// DropSlotRef returns copy of program that does not use user slot
+func DropSlotRef(data []byte, ref prologue.SlotRef) ([]byte, error) {
+	out, err := prologue.DropSlotRef(data, ref)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot remove reference to %s", ref)
+	}
+	return out, nil
+}
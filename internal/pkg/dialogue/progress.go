@@ -0,0 +1,81 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import "sync"
+
+// Phase of a transfer
+type Phase int
+
+// Transfer phases in order
+const (
+	PhaseEncode Phase = iota
+	PhaseSend
+	PhaseReceive // Waiting for & receiving reply
+	PhaseDecode
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseEncode:
+		return "encode"
+	case PhaseSend:
+		return "send"
+	case PhaseReceive:
+		return "receive"
+	case PhaseDecode:
+		return "decode"
+	default:
+		return "unknown"
+	}
+}
+
+// Progress of a transfer. Total is 0 if not known (e.g. size of reply).
+type Progress struct {
+	Phase Phase
+	Done  int
+	Total int
+}
+
+// ProgressFunc is called during transfers, possibly from MIDI driver's goroutine
+type ProgressFunc func(Progress)
+
+// Minimum number of received bytes between progress reports
+const progressReceiveStep = 1024
+
+var progress struct {
+	sync.Mutex
+	f ProgressFunc
+}
+
+// SetProgress sets the callback for transfer progress (nil disables)
+func SetProgress(f ProgressFunc) {
+	progress.Lock()
+	progress.f = f
+	progress.Unlock()
+}
+
+func reportProgress(phase Phase, done int, total int) {
+	progress.Lock()
+	f := progress.f
+	progress.Unlock()
+
+	if f != nil {
+		f(Progress{Phase: phase, Done: done, Total: total})
+	}
+}
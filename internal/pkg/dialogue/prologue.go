@@ -33,6 +33,8 @@ func (p Prologue) getDeviceSpecificInfo() DeviceSpecificInfo {
 		programFilesize:          336,
 		midiNamePrefix:           "prologue",
 		programRange:             ProgramRange{1, 500},	
+		tuningScaleCount:         6,
+		tuningOctaveCount:        6,
 	}
 }
 
@@ -0,0 +1,62 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+)
+
+// Difference of one parameter between two programs. Bytes not covered by
+// parameters are compared as 'unknown.<offset>' ranges (values as hex).
+type Difference struct {
+	Name string `json:"param"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// Diff returns differing parameters of program data a and b in program
+// data order
+func Diff(a []byte, b []byte) ([]Difference, error) {
+	if _, err := ToProgram(a); err != nil {
+		return nil, err
+	}
+	if _, err := ToProgram(b); err != nil {
+		return nil, err
+	}
+
+	var diffs []Difference
+	for _, p := range params {
+		ta, tb := p.Text(a), p.Text(b)
+		if ta != tb {
+			diffs = append(diffs, Difference{p.Name, ta, tb})
+		}
+	}
+	for _, r := range unknownRanges() {
+		ra, rb := a[r[0]:r[1]], b[r[0]:r[1]]
+		if !bytes.Equal(ra, rb) {
+			diffs = append(diffs, Difference{
+				unknownKey + "." + strconv.Itoa(r[0]),
+				hex.EncodeToString(ra),
+				hex.EncodeToString(rb),
+			})
+		}
+	}
+	return diffs, nil
+}
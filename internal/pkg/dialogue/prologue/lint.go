@@ -0,0 +1,153 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Issue is a problem found in program data
+type Issue struct {
+	Name    string `json:"param"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+// SlotRef is a reference from program to user unit slot
+type SlotRef struct {
+	Name   string `json:"param"`  // Parameter holding the slot, e.g. "main.multi.user"
+	Module string `json:"module"` // Module of the slot ("osc", "modfx", "delfx" or "revfx")
+	Slot   int    `json:"slot"`
+}
+
+func (r SlotRef) String() string {
+	return fmt.Sprintf("%s/%d", r.Module, r.Slot)
+}
+
+// Lint checks program name and parameter values against their legal ranges
+func Lint(data []byte) ([]Issue, error) {
+	if _, err := ToProgram(data); err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	for _, p := range params {
+		if p.Unit == UnitName {
+			if err := CheckName(p.Text(data)); err != nil {
+				issues = append(issues, Issue{p.Name, fmt.Sprintf("%q", p.Text(data)), err.Error()})
+			}
+			continue
+		}
+		if v := p.Value(data); v < p.Min || v > p.Max {
+			issues = append(issues, Issue{p.Name, fmt.Sprint(v), fmt.Sprintf("out of range (%d~%d)", p.Min, p.Max)})
+		}
+	}
+	return issues, nil
+}
+
+// Sanitize returns copy of program data with invalid name characters replaced
+// by spaces, numbers clamped to their range and unknown value names set to
+// the first value
+func Sanitize(data []byte) ([]byte, error) {
+	if _, err := ToProgram(data); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(nil), data...)
+	for _, p := range params {
+		if p.Unit == UnitName {
+			name := bytes.TrimRight(out[p.Offset:p.Offset+p.Size], "\x00")
+			for i, c := range name {
+				if c < ' ' || c > '~' {
+					name[i] = ' '
+				}
+			}
+			continue
+		}
+
+		v := p.Value(out)
+		switch {
+		case v >= p.Min && v <= p.Max:
+			continue
+		case p.Unit == UnitEnum:
+			v = p.Min
+		case v < p.Min:
+			v = p.Min
+		default:
+			v = p.Max
+		}
+		p.SetValue(out, v)
+	}
+	return out, nil
+}
+
+// UserSlotRefs returns user unit slots program uses: user oscillator of
+// the multi engine, user modulation effect (if turned on) and user delay or
+// reverb effect (if selected)
+func UserSlotRefs(data []byte) ([]SlotRef, error) {
+	prog, err := ToProgram(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []SlotRef
+	for _, t := range []TimbreID{MainTimbre, SubTimbre} {
+		timbre := prog.Main
+		if t == SubTimbre {
+			timbre = prog.Sub
+		}
+		if timbre.Multi.Type == MultiUser {
+			refs = append(refs, SlotRef{t.String() + ".multi.user", "osc", int(timbre.Multi.User)})
+		}
+	}
+	if prog.ModFX.On != 0 && prog.ModFX.Type == ModFXUser {
+		refs = append(refs, SlotRef{"mod_fx.user", "modfx", int(prog.ModFX.User)})
+	}
+	switch d := prog.DelayReverb; {
+	case d.Select == DelayReverbDelay && d.Delay >= DelayUserFirst:
+		refs = append(refs, SlotRef{"delay_reverb.delay", "delfx", int(d.Delay) - DelayUserFirst})
+	case d.Select == DelayReverbReverb && d.Reverb >= ReverbUserFirst:
+		refs = append(refs, SlotRef{"delay_reverb.reverb", "revfx", int(d.Reverb) - ReverbUserFirst})
+	}
+	return refs, nil
+}
+
+// DropSlotRef returns copy of program that does not use the user slot of
+// ref: multi engine is set to noise, modulation, delay or reverb effect is
+// turned off
+func DropSlotRef(data []byte, ref SlotRef) ([]byte, error) {
+	prog, err := ToProgram(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ref.Name {
+	case "main.multi.user":
+		prog.Main.Multi.Type = MultiNoise
+	case "sub.multi.user":
+		prog.Sub.Multi.Type = MultiNoise
+	case "mod_fx.user":
+		prog.ModFX.On = 0
+	case "delay_reverb.delay", "delay_reverb.reverb":
+		prog.DelayReverb.Select = DelayReverbOff
+	default:
+		return nil, fmt.Errorf("'%s' is not a user slot parameter", ref.Name)
+	}
+	return prog.FromProgram(), nil
+}
@@ -0,0 +1,83 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestLintAndSanitize(t *testing.T) {
+	tests := []struct {
+		param string
+		value int
+		clamp int
+	}{
+		{"mod_fx.chorus", 8, 7},
+		{"mod_fx.ensemble", 3, 2},
+		{"mod_fx.phaser", 200, 7},
+		{"mod_fx.flanger", 8, 7},
+		{"delay_reverb.delay", 20, 19},
+		{"delay_reverb.reverb", 18, 17},
+		{"tempo", 50, 100},
+		{"main.filter.cutoff", 1024, 1023},
+	}
+
+	for _, test := range tests {
+		p, ok := FindParam(test.param)
+		if !ok {
+			t.Fatalf("Unknown parameter %s", test.param)
+		}
+		data := typicalProgram().FromProgram()
+		// SetValue refuses values out of range
+		if p.Size == 2 {
+			binary.LittleEndian.PutUint16(data[p.Offset:], uint16(test.value))
+		} else {
+			data[p.Offset] = byte(test.value)
+		}
+
+		issues, err := Lint(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != 1 || issues[0].Name != test.param {
+			t.Errorf("%s = %d: issues %v, want one for %s", test.param, test.value, issues, test.param)
+		}
+
+		out, err := Sanitize(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := p.Value(out); v != test.clamp {
+			t.Errorf("%s = %d: sanitized to %d, want %d", test.param, test.value, v, test.clamp)
+		}
+		if issues, _ := Lint(out); len(issues) != 0 {
+			t.Errorf("%s = %d: issues after Sanitize: %v", test.param, test.value, issues)
+		}
+	}
+}
+
+func TestLintValidProgram(t *testing.T) {
+	issues, err := Lint(typicalProgram().FromProgram())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Issues in valid program: %v", issues)
+	}
+}
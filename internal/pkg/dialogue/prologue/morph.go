@@ -0,0 +1,53 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"fmt"
+	"math"
+)
+
+// Morph returns blend of programs a and b at position t (0 = a, 1 = b).
+// Continuous parameters are interpolated, discrete ones (and bytes not
+// covered by parameters) switch from a to b when t reaches threshold.
+func Morph(a []byte, b []byte, t float64, threshold float64) ([]byte, error) {
+	if _, err := ToProgram(a); err != nil {
+		return nil, err
+	}
+	if _, err := ToProgram(b); err != nil {
+		return nil, err
+	}
+	if t < 0 || t > 1 {
+		return nil, fmt.Errorf("morph position %g is out of range (0~1)", t)
+	}
+
+	data := append([]byte(nil), a...)
+	if t >= threshold {
+		copy(data, b)
+	}
+
+	for _, p := range params {
+		if p.Discrete {
+			continue
+		}
+		va, vb := float64(p.Value(a)), float64(p.Value(b))
+		// Out of range values (only if a or b is out of range) keep the copied value
+		p.SetValue(data, int(math.Round(va+(vb-va)*t)))
+	}
+	return data, nil
+}
@@ -0,0 +1,322 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Unit of a parameter value in text form
+type Unit int
+
+// Parameter units
+const (
+	UnitNumber  Unit = iota // Value as is
+	UnitName                // Program name
+	UnitEnum                // Value name (e.g. "SAW")
+	UnitBipolar             // Value - 512
+	UnitTempo               // BPM (value / 10)
+	UnitNote                // Note name (e.g. "C4")
+)
+
+// Param is one named parameter of program data
+type Param struct {
+	Name   string // Path in lower case, e.g. "main.filter.cutoff"
+	Offset int    // Offset in program data
+	Size   int    // Size in bytes
+	Min    int
+	Max    int
+	Unit   Unit
+	Values []string // Value names of UnitEnum
+
+	// Discrete values are selections (types, slots, switches) that cannot
+	// be interpolated
+	Discrete bool
+}
+
+var valueNames = map[reflect.Type][]string{
+	reflect.TypeOf(Switch(0)):            switchNames,
+	reflect.TypeOf(TimbreType(0)):        timbreTypeNames,
+	reflect.TypeOf(VoiceMode(0)):         voiceModeNames,
+	reflect.TypeOf(ArpType(0)):           arpTypeNames,
+	reflect.TypeOf(Wave(0)):              waveNames,
+	reflect.TypeOf(Octave(0)):            octaveNames,
+	reflect.TypeOf(MultiType(0)):         multiTypeNames,
+	reflect.TypeOf(Amount(0)):            amountNames,
+	reflect.TypeOf(EGTarget(0)):          egTargetNames,
+	reflect.TypeOf(LFOMode(0)):           lfoModeNames,
+	reflect.TypeOf(LFOTarget(0)):         lfoTargetNames,
+	reflect.TypeOf(ModFXType(0)):         modFXTypeNames,
+	reflect.TypeOf(DelayReverbSelect(0)): delayReverbSelectNames,
+}
+
+var unitNames = map[string]Unit{
+	"":        UnitNumber,
+	"bipolar": UnitBipolar,
+	"tempo":   UnitTempo,
+	"note":    UnitNote,
+}
+
+var params = buildParams()
+
+// Params returns the named parameters in program data order
+func Params() []Param {
+	return append([]Param(nil), params...)
+}
+
+// FindParam returns parameter by name
+func FindParam(name string) (Param, bool) {
+	for _, p := range params {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+func buildParams() []Param {
+	var list []Param
+	walkType(reflect.TypeOf(Program{}), 0, "", func(f reflect.StructField, offset int, name string) {
+		p := Param{Name: name, Offset: offset}
+
+		switch f.Type.Kind() {
+		case reflect.String:
+			p.Size, p.Unit = nameSize, UnitName
+		case reflect.Uint8:
+			p.Size, p.Max = 1, 127
+		case reflect.Uint16:
+			p.Size, p.Max = 2, 1023
+		}
+
+		if names, ok := valueNames[f.Type]; ok {
+			p.Unit, p.Values, p.Max = UnitEnum, names, len(names)-1
+		}
+		if unit, ok := unitNames[f.Tag.Get("unit")]; ok && p.Unit == UnitNumber {
+			p.Unit = unit
+		}
+		if min, err := strconv.Atoi(f.Tag.Get("min")); err == nil {
+			p.Min = min
+		}
+		if max, err := strconv.Atoi(f.Tag.Get("max")); err == nil {
+			p.Max = max
+		}
+		p.Discrete = p.Unit == UnitName || p.Unit == UnitEnum || p.Unit == UnitNote || f.Tag.Get("discrete") == "true"
+
+		list = append(list, p)
+	})
+	return list
+}
+
+// walkType calls f for each tagged field (excluding structs) with its
+// absolute offset and parameter name
+func walkType(t reflect.Type, base int, prefix string, f func(field reflect.StructField, offset int, name string)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("prog")
+		if !ok {
+			continue
+		}
+		offset, err := strconv.Atoi(tag)
+		if err != nil {
+			panic(fmt.Sprintf("prologue: bad offset tag on %s.%s", t.Name(), field.Name))
+		}
+
+		name := prefix + snakeCase(field.Name)
+		if field.Type.Kind() == reflect.Struct {
+			walkType(field.Type, base+offset, name+".", f)
+			continue
+		}
+		f(field, base+offset, name)
+	}
+}
+
+// snakeCase converts Go field name to parameter name (e.g. "ShapeVPM" -> "shape_vpm")
+func snakeCase(s string) string {
+	r := []rune(s)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			prev := r[i-1]
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// IsTimbre tells if parameter belongs to main or sub timbre
+func (p Param) IsTimbre() bool {
+	return strings.HasPrefix(p.Name, "main.") || strings.HasPrefix(p.Name, "sub.")
+}
+
+// Value returns raw value of parameter in program data
+func (p Param) Value(data []byte) int {
+	switch p.Size {
+	case 1:
+		return int(data[p.Offset])
+	case 2:
+		return int(binary.LittleEndian.Uint16(data[p.Offset:]))
+	}
+	return 0
+}
+
+// SetValue sets raw value of parameter in program data
+func (p Param) SetValue(data []byte, v int) error {
+	if p.Unit == UnitName {
+		return fmt.Errorf("%s is not a number", p.Name)
+	}
+	if v < p.Min || v > p.Max {
+		return fmt.Errorf("%s: value %d out of range (%d~%d)", p.Name, v, p.Min, p.Max)
+	}
+	switch p.Size {
+	case 1:
+		data[p.Offset] = byte(v)
+	case 2:
+		binary.LittleEndian.PutUint16(data[p.Offset:], uint16(v))
+	}
+	return nil
+}
+
+// Text returns parameter value of program data in text form
+func (p Param) Text(data []byte) string {
+	if p.Unit == UnitName {
+		// Bytes as runes (Latin-1), so that any stored name survives text form
+		var name []rune
+		for _, b := range bytes.TrimRight(data[p.Offset:p.Offset+p.Size], "\x00") {
+			name = append(name, rune(b))
+		}
+		return string(name)
+	}
+	return p.Format(p.Value(data))
+}
+
+// SetText sets parameter value of program data from text form
+func (p Param) SetText(data []byte, s string) error {
+	if p.Unit == UnitName {
+		// Name is stored as given (see Text), CheckName tells if the device can show it
+		name := make([]byte, 0, p.Size)
+		for _, c := range s {
+			if c > 0xFF {
+				return fmt.Errorf("name '%s' has invalid character %q", s, c)
+			}
+			name = append(name, byte(c))
+		}
+		if len(name) > p.Size {
+			return fmt.Errorf("name '%s' is longer than %d characters", s, p.Size)
+		}
+		copy(data[p.Offset:p.Offset+p.Size], append(name, make([]byte, p.Size-len(name))...))
+		return nil
+	}
+
+	v, err := p.Parse(s)
+	if err != nil {
+		return err
+	}
+	return p.SetValue(data, v)
+}
+
+// Format returns raw value in text form
+func (p Param) Format(v int) string {
+	switch p.Unit {
+	case UnitEnum:
+		return valueName(p.Values, byte(v))
+	case UnitBipolar:
+		return strconv.Itoa(v - 512)
+	case UnitTempo:
+		return fmt.Sprintf("%d.%d", v/10, v%10)
+	case UnitNote:
+		return noteName(v)
+	}
+	return strconv.Itoa(v)
+}
+
+// Parse returns raw value of text form (range is not checked)
+func (p Param) Parse(s string) (int, error) {
+	s = strings.TrimSpace(s)
+
+	switch p.Unit {
+	case UnitEnum:
+		for i, name := range p.Values {
+			if strings.EqualFold(s, name) {
+				return i, nil
+			}
+		}
+	case UnitBipolar:
+		if v, err := strconv.Atoi(s); err == nil {
+			return v + 512, nil
+		}
+	case UnitTempo:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return int(f*10 + 0.5), nil
+		}
+	case UnitNote:
+		if v, ok := parseNoteName(s); ok {
+			return v, nil
+		}
+	}
+
+	// Plain number is accepted for all units
+	if v, err := strconv.Atoi(s); err == nil && p.Unit != UnitBipolar {
+		return v, nil
+	}
+	return 0, fmt.Errorf("%s: invalid value '%s'", p.Name, s)
+}
+
+// CheckName checks that program name fits in 12 characters and has only
+// characters the device can show (printable ASCII)
+func CheckName(name string) error {
+	if len(name) > nameSize {
+		return fmt.Errorf("name '%s' is longer than %d characters", name, nameSize)
+	}
+	for _, c := range name {
+		if c < ' ' || c > '~' {
+			return fmt.Errorf("name '%s' has invalid character %q", name, c)
+		}
+	}
+	return nil
+}
+
+var noteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// noteName returns name of MIDI note number (60 = C4)
+func noteName(n int) string {
+	return fmt.Sprintf("%s%d", noteNames[n%12], n/12-1)
+}
+
+func parseNoteName(s string) (int, bool) {
+	for i := len(noteNames) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(strings.ToUpper(s), noteNames[i]) {
+			continue
+		}
+		octave, err := strconv.Atoi(s[len(noteNames[i]):])
+		if err != nil {
+			return 0, false
+		}
+		return (octave+1)*12 + i, true
+	}
+	return 0, false
+}
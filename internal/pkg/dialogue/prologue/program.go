@@ -0,0 +1,241 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Program data layout follows the prologue MIDI implementation (program
+// parameter table). The 'prog' tag of each field is its byte offset, relative
+// to the enclosing struct. 8-bit types take one byte, 16-bit types two bytes
+// (little endian, 10-bit values 0~1023). Bytes not described here are kept
+// as is. Optional 'min', 'max', 'unit' and 'discrete' tags are used for the named
+// parameters (see Params).
+
+// ProgramSize is the size of program data (.prog_bin)
+const ProgramSize = 336
+
+// TimbreSize is the size of one timbre in program data
+const TimbreSize = 144
+
+const nameSize = 12
+
+var programMagic = []byte("PROG")
+
+// Program is the prologue program
+type Program struct {
+	Name           string      `prog:"4"`
+	TimbreType     TimbreType  `prog:"16"`
+	MainSubBalance uint16      `prog:"17"`
+	SplitPoint     byte        `prog:"19" unit:"note"`
+	ProgramLevel   byte        `prog:"20"`
+	Tempo          uint16      `prog:"21" min:"100" max:"3000" unit:"tempo"` // BPM x 10
+	Arp            Arp         `prog:"23"`
+	ModFX          ModFX       `prog:"26"`
+	DelayReverb    DelayReverb `prog:"37"`
+	Main           Timbre      `prog:"44"`
+	Sub            Timbre      `prog:"188"`
+
+	raw [ProgramSize]byte
+}
+
+// Arp is the arpeggiator setting
+type Arp struct {
+	On    Switch  `prog:"0"`
+	Type  ArpType `prog:"1"`
+	Range byte    `prog:"2" max:"3" discrete:"true"` // 0~3 = 1~4 octaves
+}
+
+// ModFX is the modulation effect setting. Each effect type has its own sub type.
+type ModFX struct {
+	On       Switch    `prog:"0"`
+	Type     ModFXType `prog:"1"`
+	Chorus   byte      `prog:"2" max:"7" discrete:"true"`  // 8 chorus types
+	Ensemble byte      `prog:"3" max:"2" discrete:"true"`  // 3 ensemble types
+	Phaser   byte      `prog:"4" max:"7" discrete:"true"`  // 8 phaser types
+	Flanger  byte      `prog:"5" max:"7" discrete:"true"`  // 8 flanger types
+	User     byte      `prog:"6" max:"15" discrete:"true"` // User modfx slot
+	Speed    uint16    `prog:"7"`
+	Depth    uint16    `prog:"9"`
+}
+
+// DelayReverb is the delay/reverb effect setting
+type DelayReverb struct {
+	Select DelayReverbSelect `prog:"0"`
+	Delay  byte              `prog:"1" max:"19" discrete:"true"` // Delay sub type, user slots from DelayUserFirst
+	Reverb byte              `prog:"2" max:"17" discrete:"true"` // Reverb sub type, user slots from ReverbUserFirst
+	Time   uint16            `prog:"3"`
+	Depth  uint16            `prog:"5"`
+}
+
+// Timbre is the main or sub timbre of a program
+type Timbre struct {
+	VoiceMode      VoiceMode `prog:"0"`
+	VoiceModeDepth uint16    `prog:"1"`
+	Portamento     byte      `prog:"3"` // 0 = Off
+	VCO1           VCO       `prog:"5"`
+	VCO2           VCO       `prog:"11"`
+	Sync           Switch    `prog:"17"`
+	Ring           Switch    `prog:"18"`
+	CrossModDepth  uint16    `prog:"19"`
+	Multi          Multi     `prog:"21"`
+	Mixer          Mixer     `prog:"35"`
+	Filter         Filter    `prog:"41"`
+	AmpEG          AmpEG     `prog:"48"`
+	EG             EG        `prog:"56"`
+	LFO            LFO       `prog:"63"`
+}
+
+// VCO is an analog oscillator
+type VCO struct {
+	Wave   Wave   `prog:"0"`
+	Octave Octave `prog:"1"`
+	Pitch  uint16 `prog:"2"`
+	Shape  uint16 `prog:"4"`
+}
+
+// Multi is the multi engine (noise, VPM or user oscillator)
+type Multi struct {
+	Type           MultiType `prog:"0"`
+	Noise          byte      `prog:"1" max:"3" discrete:"true"`  // Noise type
+	VPM            byte      `prog:"2" max:"15" discrete:"true"` // VPM type
+	User           byte      `prog:"3" max:"15" discrete:"true"` // User osc slot
+	ShapeNoise     uint16    `prog:"4"`
+	ShapeVPM       uint16    `prog:"6"`
+	ShapeUser      uint16    `prog:"8"`
+	ShiftShapeVPM  uint16    `prog:"10"`
+	ShiftShapeUser uint16    `prog:"12"`
+}
+
+// Mixer holds the oscillator levels
+type Mixer struct {
+	VCO1  uint16 `prog:"0"`
+	VCO2  uint16 `prog:"2"`
+	Multi uint16 `prog:"4"`
+}
+
+// Filter is the low pass filter
+type Filter struct {
+	Cutoff    uint16 `prog:"0"`
+	Resonance uint16 `prog:"2"`
+	LowCut    Switch `prog:"4"`
+	KeyTrack  Amount `prog:"5"`
+	Velocity  Amount `prog:"6"`
+}
+
+// AmpEG is the amplifier envelope
+type AmpEG struct {
+	Attack  uint16 `prog:"0"`
+	Decay   uint16 `prog:"2"`
+	Sustain uint16 `prog:"4"`
+	Release uint16 `prog:"6"`
+}
+
+// EG is the modulation envelope
+type EG struct {
+	Attack uint16   `prog:"0"`
+	Decay  uint16   `prog:"2"`
+	Int    uint16   `prog:"4" unit:"bipolar"` // 512 = 0
+	Target EGTarget `prog:"6"`
+}
+
+// LFO is the low frequency oscillator
+type LFO struct {
+	Wave   Wave      `prog:"0"`
+	Mode   LFOMode   `prog:"1"`
+	Rate   uint16    `prog:"2"`
+	Int    uint16    `prog:"4" unit:"bipolar"` // 512 = 0
+	Target LFOTarget `prog:"6"`
+}
+
+// ToProgram decodes program data
+func ToProgram(data []byte) (Program, error) {
+	var p Program
+
+	if len(data) != ProgramSize {
+		return p, fmt.Errorf("program data is %d bytes, expected %d", len(data), ProgramSize)
+	}
+	if !bytes.HasPrefix(data, programMagic) {
+		return p, fmt.Errorf("program data does not start with '%s'", programMagic)
+	}
+
+	copy(p.raw[:], data)
+	walk(reflect.ValueOf(&p).Elem(), 0, func(v reflect.Value, offset int) {
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(string(bytes.TrimRight(data[offset:offset+nameSize], "\x00")))
+		case reflect.Uint8:
+			v.SetUint(uint64(data[offset]))
+		case reflect.Uint16:
+			v.SetUint(uint64(binary.LittleEndian.Uint16(data[offset:])))
+		}
+	})
+
+	return p, nil
+}
+
+// FromProgram encodes program data. Bytes not in the model are kept from
+// the decoded data (new program starts from zeros).
+func (p Program) FromProgram() []byte {
+	data := make([]byte, ProgramSize)
+	copy(data, p.raw[:])
+	copy(data, programMagic)
+
+	walk(reflect.ValueOf(&p).Elem(), 0, func(v reflect.Value, offset int) {
+		switch v.Kind() {
+		case reflect.String:
+			name := make([]byte, nameSize)
+			copy(name, v.String())
+			copy(data[offset:], name)
+		case reflect.Uint8:
+			data[offset] = byte(v.Uint())
+		case reflect.Uint16:
+			binary.LittleEndian.PutUint16(data[offset:], uint16(v.Uint()))
+		}
+	})
+
+	return data
+}
+
+// walk calls f for each tagged field (excluding structs) with its
+// absolute offset
+func walk(v reflect.Value, base int, f func(v reflect.Value, offset int)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("prog")
+		if !ok {
+			continue
+		}
+		offset, err := strconv.Atoi(tag)
+		if err != nil {
+			panic(fmt.Sprintf("prologue: bad offset tag on %s.%s", t.Name(), t.Field(i).Name))
+		}
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walk(field, base+offset, f)
+			continue
+		}
+		f(field, base+offset)
+	}
+}
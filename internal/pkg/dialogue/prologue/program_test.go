@@ -0,0 +1,180 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// randomDump returns program data with random bytes after the magic
+func randomDump(rnd *rand.Rand) []byte {
+	data := make([]byte, ProgramSize)
+	rnd.Read(data)
+	copy(data, programMagic)
+	return data
+}
+
+// typicalProgram returns a program as saved by the device: a layered
+// sound with the values in their normal ranges and the rest zero
+func typicalProgram() Program {
+	p := Program{
+		Name:           "Warm Pad",
+		TimbreType:     TimbreLayer,
+		MainSubBalance: 512,
+		SplitPoint:     60,
+		ProgramLevel:   102,
+		Tempo:          1200,
+		Arp:            Arp{On: 1, Type: 2, Range: 1},
+		ModFX:          ModFX{On: 1, Type: ModFXEnsemble, Ensemble: 2, Speed: 300, Depth: 700},
+		DelayReverb:    DelayReverb{Select: DelayReverbReverb, Reverb: 3, Time: 600, Depth: 400},
+	}
+	for i, t := range []*Timbre{&p.Main, &p.Sub} {
+		*t = Timbre{
+			VoiceModeDepth: 1023,
+			VCO1:           VCO{Wave: 2, Octave: 1, Pitch: 512, Shape: 100},
+			VCO2:           VCO{Wave: 1, Octave: 2, Pitch: 530 + uint16(i), Shape: 0},
+			Multi:          Multi{Type: MultiVPM, VPM: 5, ShapeVPM: 400, ShiftShapeVPM: 300},
+			Mixer:          Mixer{VCO1: 800, VCO2: 600, Multi: 200},
+			Filter:         Filter{Cutoff: 700, Resonance: 100, KeyTrack: 1, Velocity: 2},
+			AmpEG:          AmpEG{Attack: 300, Decay: 500, Sustain: 900, Release: 600},
+			EG:             EG{Attack: 0, Decay: 400, Int: 600, Target: 0},
+			LFO:            LFO{Wave: 1, Mode: 1, Rate: 200, Int: 530, Target: 2},
+		}
+	}
+	return p
+}
+
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	dumps := [][]byte{typicalProgram().FromProgram(), Program{}.FromProgram()}
+	for i := 0; i < 200; i++ {
+		dumps = append(dumps, randomDump(rnd))
+	}
+
+	for i, data := range dumps {
+		p, err := ToProgram(data)
+		if err != nil {
+			t.Fatalf("Dump %d: ToProgram: %v", i, err)
+		}
+		if out := p.FromProgram(); !bytes.Equal(out, data) {
+			t.Fatalf("Dump %d: FromProgram(ToProgram(d)) != d\n got %x\nwant %x", i, out, data)
+		}
+	}
+
+	p, _ := ToProgram(typicalProgram().FromProgram())
+	p.raw = [ProgramSize]byte{}
+	if want := typicalProgram(); !reflect.DeepEqual(p, want) {
+		t.Errorf("ToProgram(FromProgram(p)) = %+v, want %+v", p, want)
+	}
+}
+
+// fieldSize returns number of bytes of tagged field
+func fieldSize(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.String:
+		return nameSize
+	case reflect.Uint16:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// fieldBytes returns the owner (field path) of each program byte
+func fieldBytes(t *testing.T) []string {
+	owners := make([]string, ProgramSize)
+	for i := range programMagic {
+		owners[i] = "magic"
+	}
+
+	var visit func(v reflect.Value, path string, base int)
+	visit = func(v reflect.Value, path string, base int) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			tag, ok := field.Tag.Lookup("prog")
+			if !ok {
+				continue
+			}
+			offset, err := strconv.Atoi(tag)
+			if err != nil {
+				t.Fatalf("Bad offset tag on %s%s", path, field.Name)
+			}
+			name := path + field.Name
+			if v.Field(i).Kind() == reflect.Struct {
+				visit(v.Field(i), name+".", base+offset)
+				continue
+			}
+			for b := base + offset; b < base+offset+fieldSize(v.Field(i)); b++ {
+				if b >= ProgramSize {
+					t.Fatalf("%s (offset %d) is beyond program data", name, base+offset)
+				}
+				if owners[b] != "" {
+					t.Errorf("%s overlaps %s at byte %d", name, owners[b], b)
+				}
+				owners[b] = name
+			}
+		}
+	}
+	visit(reflect.ValueOf(Program{}), "", 0)
+	return owners
+}
+
+func TestOffsetsDoNotOverlap(t *testing.T) {
+	owners := fieldBytes(t)
+
+	// Timbre fields stay inside their timbre
+	for b, owner := range owners {
+		for _, timbre := range []struct {
+			prefix string
+			start  int
+		}{{"Main.", 44}, {"Sub.", 188}} {
+			if strings.HasPrefix(owner, timbre.prefix) && (b < timbre.start || b >= timbre.start+TimbreSize) {
+				t.Errorf("%s at byte %d is outside of timbre %d-%d", owner, b, timbre.start, timbre.start+TimbreSize-1)
+			}
+		}
+	}
+}
+
+func TestUnknownBytesKept(t *testing.T) {
+	owners := fieldBytes(t)
+	rnd := rand.New(rand.NewSource(2))
+	data := randomDump(rnd)
+
+	// Change every known parameter, unknown bytes must stay
+	p, err := ToProgram(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := typicalProgram()
+	known.raw = p.raw
+	out := known.FromProgram()
+
+	for b := range out {
+		if owners[b] == "" && out[b] != data[b] {
+			t.Errorf("Unknown byte %d changed from %#x to %#x", b, data[b], out[b])
+		}
+	}
+	if !bytes.Equal(out[:len(programMagic)], programMagic) {
+		t.Errorf("Program data starts with %q", out[:len(programMagic)])
+	}
+}
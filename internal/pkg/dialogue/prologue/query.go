@@ -0,0 +1,341 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a condition over program parameters, e.g.
+//
+//	sync = on and filter.cutoff < 300
+//	name ~ pad or (main.multi.type = user and not arp.on = on)
+//
+// Conditions are '<param> <op> <value>' with operators = != < <= > >= and
+// ~ !~ (text contains, case insensitive). Parameters are named as in Params.
+// A timbre parameter without "main." or "sub." matches if either timbre
+// matches. Values are given in text form (e.g. "SAW", "C4", "-100"), or
+// quoted if they contain spaces or operator characters.
+type Query struct {
+	root matcher
+	text string
+}
+
+type matcher interface {
+	match(data []byte) bool
+}
+
+type orExpr []matcher
+
+func (e orExpr) match(data []byte) bool {
+	for _, m := range e {
+		if m.match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+type andExpr []matcher
+
+func (e andExpr) match(data []byte) bool {
+	for _, m := range e {
+		if !m.match(data) {
+			return false
+		}
+	}
+	return true
+}
+
+type notExpr struct {
+	m matcher
+}
+
+func (e notExpr) match(data []byte) bool { return !e.m.match(data) }
+
+type condition struct {
+	params []Param // Any of these must match
+	op     string
+	text   string
+	value  int
+}
+
+func (c condition) match(data []byte) bool {
+	for _, p := range c.params {
+		if c.matchParam(p, data) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c condition) matchParam(p Param, data []byte) bool {
+	switch c.op {
+	case "~":
+		return strings.Contains(strings.ToLower(p.Text(data)), strings.ToLower(c.text))
+	case "!~":
+		return !strings.Contains(strings.ToLower(p.Text(data)), strings.ToLower(c.text))
+	}
+
+	var cmp int
+	if p.Unit == UnitName {
+		cmp = strings.Compare(strings.ToLower(p.Text(data)), strings.ToLower(c.text))
+	} else {
+		v := p.Value(data)
+		switch {
+		case v < c.value:
+			cmp = -1
+		case v > c.value:
+			cmp = 1
+		}
+	}
+
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// Match tells if program data matches the query
+func (q Query) Match(data []byte) bool {
+	if len(data) != ProgramSize || q.root == nil {
+		return false
+	}
+	return q.root.match(data)
+}
+
+func (q Query) String() string { return q.text }
+
+// ParseQuery parses query text
+func ParseQuery(text string) (Query, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return Query{}, err
+	}
+
+	qp := &queryParser{tokens: tokens}
+	root, err := qp.parseOr()
+	if err != nil {
+		return Query{}, err
+	}
+	if qp.pos < len(qp.tokens) {
+		return Query{}, fmt.Errorf("unexpected '%s'", qp.tokens[qp.pos].text)
+	}
+	return Query{root: root, text: text}, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+const queryOperatorChars = "=!<>~"
+
+func tokenizeQuery(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			v, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:end+1])
+			}
+			tokens = append(tokens, token{text: v, quoted: true})
+			i = end + 1
+
+		case strings.IndexByte(queryOperatorChars, c) >= 0:
+			end := i
+			for end < len(s) && strings.IndexByte(queryOperatorChars, s[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, token{text: s[i:end]})
+			i = end
+
+		default:
+			end := i
+			for end < len(s) && !unicode.IsSpace(rune(s[end])) &&
+				!strings.ContainsRune("()\""+queryOperatorChars, rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: s[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+}
+
+func (qp *queryParser) peek() (token, bool) {
+	if qp.pos < len(qp.tokens) {
+		return qp.tokens[qp.pos], true
+	}
+	return token{}, false
+}
+
+// keyword tells if next token is one of the given keywords (and consumes it)
+func (qp *queryParser) keyword(words ...string) bool {
+	t, ok := qp.peek()
+	if !ok || t.quoted {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			qp.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (qp *queryParser) parseOr() (matcher, error) {
+	var e orExpr
+	for {
+		m, err := qp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		e = append(e, m)
+		if !qp.keyword("or", "||") {
+			break
+		}
+	}
+	if len(e) == 1 {
+		return e[0], nil
+	}
+	return e, nil
+}
+
+func (qp *queryParser) parseAnd() (matcher, error) {
+	var e andExpr
+	for {
+		m, err := qp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		e = append(e, m)
+		if !qp.keyword("and", "&&") {
+			break
+		}
+	}
+	if len(e) == 1 {
+		return e[0], nil
+	}
+	return e, nil
+}
+
+func (qp *queryParser) parseUnary() (matcher, error) {
+	if qp.keyword("not", "!") {
+		m, err := qp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{m}, nil
+	}
+	if qp.keyword("(") {
+		m, err := qp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !qp.keyword(")") {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		return m, nil
+	}
+	return qp.parseCondition()
+}
+
+func (qp *queryParser) parseCondition() (matcher, error) {
+	if qp.pos+3 > len(qp.tokens) {
+		return nil, fmt.Errorf("expected '<param> <op> <value>'")
+	}
+	name, op, value := qp.tokens[qp.pos], qp.tokens[qp.pos+1], qp.tokens[qp.pos+2]
+	qp.pos += 3
+
+	c := condition{op: op.text, text: value.text}
+	switch c.op {
+	case "==":
+		c.op = "="
+	case "=", "!=", "<", "<=", ">", ">=", "~", "!~":
+	default:
+		return nil, fmt.Errorf("unknown operator '%s'", op.text)
+	}
+
+	c.params = queryParams(strings.ToLower(name.text))
+	if len(c.params) == 0 {
+		return nil, fmt.Errorf("unknown parameter '%s'", name.text)
+	}
+
+	if c.op != "~" && c.op != "!~" && c.params[0].Unit != UnitName {
+		v, err := c.params[0].Parse(value.text)
+		if err != nil {
+			return nil, err
+		}
+		c.value = v
+	}
+	return c, nil
+}
+
+// queryParams returns parameters matching name in query
+func queryParams(name string) []Param {
+	if p, ok := FindParam(name); ok {
+		return []Param{p}
+	}
+	var list []Param
+	for _, timbre := range []string{"main.", "sub."} {
+		if p, ok := FindParam(timbre + name); ok {
+			list = append(list, p)
+		}
+	}
+	return list
+}
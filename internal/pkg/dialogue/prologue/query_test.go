@@ -0,0 +1,140 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	p := typicalProgram() // "Warm Pad", arp on, sync off, cutoff 700
+	p.Sub.Filter.Cutoff = 100
+	data := p.FromProgram()
+
+	tests := []struct {
+		query string
+		match bool
+	}{
+		// Operators
+		{"main.filter.cutoff = 700", true},
+		{"main.filter.cutoff == 700", true},
+		{"main.filter.cutoff != 700", false},
+		{"main.filter.cutoff < 700", false},
+		{"main.filter.cutoff <= 700", true},
+		{"main.filter.cutoff > 699", true},
+		{"main.filter.cutoff >= 701", false},
+		{"main.vco1.wave = SAW", true},
+		{"main.vco2.wave = SAW", false},
+		{"name ~ pad", true},
+		{"name ~ PAD", true},
+		{"name !~ pad", false},
+		{"name !~ lead", true},
+		{"name < Z", true},
+		{"name > Z", false},
+
+		// Timbre parameter without timbre matches either
+		{"filter.cutoff < 200", true},
+		{"main.filter.cutoff < 200", false},
+		{"sub.filter.cutoff < 200", true},
+		{"filter.cutoff > 800", false},
+
+		// Precedence: not, and, or
+		{"arp.on = on or sync = on and main.filter.cutoff = 1", true},
+		{"(arp.on = on or sync = on) and main.filter.cutoff = 1", false},
+		{"sync = on and main.filter.cutoff = 700 or arp.on = on", true},
+		{"sync = on and (main.filter.cutoff = 700 or arp.on = on)", false},
+		{"not sync = on", true},
+		{"not sync = off and arp.on = on", false},
+		{"not (sync = off and arp.on = off)", true},
+		{"not not arp.on = on", true},
+		{"! (sync = on || arp.on = off)", true},
+		{"arp.on = on && sync = off", true},
+		{"ARP.ON = on AND NOT sync = on", true},
+
+		// Quoting
+		{`name = "Warm Pad"`, true},
+		{`name = "warm pad"`, true},
+		{`name = Warm`, false},
+		{`name ~ "m P"`, true},
+		{`name !~ "<>="`, true},
+		{`name ~ "\"Pad\""`, false},
+		{`name != "and"`, true},
+		{`main.vco1.wave = "SAW"`, true},
+	}
+
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%s): %v", test.query, err)
+			continue
+		}
+		if m := q.Match(data); m != test.match {
+			t.Errorf("'%s' matches %v, want %v", test.query, m, test.match)
+		}
+		if q.String() != test.query {
+			t.Errorf("String() = '%s', want '%s'", q.String(), test.query)
+		}
+	}
+}
+
+func TestQueryMatchInvalidData(t *testing.T) {
+	q, err := ParseQuery("tempo > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Match(make([]byte, ProgramSize-1)) {
+		t.Error("Query matches short data")
+	}
+	if (Query{}).Match(typicalProgram().FromProgram()) {
+		t.Error("Empty query matches")
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"", "expected '<param> <op> <value>'"},
+		{"main.filter.cutoff", "expected '<param> <op> <value>'"},
+		{"main.filter.cutoff <", "expected '<param> <op> <value>'"},
+		{"sync = on and", "expected '<param> <op> <value>'"},
+		{"main.filter.cutoff =< 3", "unknown operator '=<'"},
+		{"main.filter.cutoff is 3", "unknown operator 'is'"},
+		{"volume = 3", "unknown parameter 'volume'"},
+		{"main.filter.cutoff = loud", "main.filter.cutoff"},
+		{"main.vco1.wave = SINE", "main.vco1.wave"},
+		{"(sync = on", "missing ')'"},
+		{"sync = on)", "unexpected ')'"},
+		{"sync = on arp.on = on", "unexpected 'arp.on'"},
+		{`name = "Warm`, "unterminated string"},
+		{`name = "\q"`, "invalid string"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseQuery(test.query)
+		if err == nil {
+			t.Errorf("ParseQuery(%s): no error", test.query)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ParseQuery(%s): error '%v', want '%s'", test.query, err, test.err)
+		}
+	}
+}
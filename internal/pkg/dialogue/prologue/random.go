@@ -0,0 +1,172 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+)
+
+// Profile controls program randomization
+type Profile struct {
+	Seed   int64                 `json:"seed"`   // Seed of first program (0 = random)
+	Ranges map[string]ValueRange `json:"ranges"` // Ranges by parameter name, full range if not given
+	Locked []string              `json:"locked"` // Parameters kept from base program (patterns like "sub.*")
+}
+
+// ValueRange is an inclusive range of parameter values in text form
+type ValueRange struct {
+	Min TextValue `json:"min"`
+	Max TextValue `json:"max"`
+}
+
+// TextValue is a parameter value in text form. In JSON it can be a string or a number.
+type TextValue string
+
+// UnmarshalJSON accepts string or number
+func (v *TextValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = TextValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("value must be a string or a number")
+	}
+	*v = TextValue(n.String())
+	return nil
+}
+
+// IsLocked tells if parameter is locked in profile
+func (pr Profile) IsLocked(name string) bool {
+	for _, pattern := range pr.Locked {
+		if ok, _ := path.Match(pattern, name); ok || strings.HasPrefix(name, pattern+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Check checks that ranges and locks refer to parameters and values are valid
+func (pr Profile) Check() error {
+	for name, r := range pr.Ranges {
+		p, ok := FindParam(name)
+		if !ok {
+			return fmt.Errorf("unknown parameter '%s' in ranges", name)
+		}
+		if _, _, err := pr.valueRange(p, r); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range pr.Locked {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad lock pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+func (pr Profile) valueRange(p Param, r ValueRange) (int, int, error) {
+	min, err := p.Parse(string(r.Min))
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := p.Parse(string(r.Max))
+	if err != nil {
+		return 0, 0, err
+	}
+	if min > max {
+		min, max = max, min
+	}
+	if min < p.Min || max > p.Max {
+		return 0, 0, fmt.Errorf("%s: range %s~%s exceeds %s~%s", p.Name, r.Min, r.Max, p.Format(p.Min), p.Format(p.Max))
+	}
+	return min, max, nil
+}
+
+// Randomize returns copy of base program with parameters that are not
+// locked set to random values of their ranges. Name is always kept.
+func Randomize(base []byte, pr Profile, seed int64) ([]byte, error) {
+	if _, err := ToProgram(base); err != nil {
+		return nil, err
+	}
+	if err := pr.Check(); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	data := append([]byte(nil), base...)
+
+	for _, p := range params {
+		if p.Unit == UnitName || pr.IsLocked(p.Name) {
+			continue
+		}
+		min, max := p.Min, p.Max
+		if r, ok := pr.Ranges[p.Name]; ok {
+			min, max, _ = pr.valueRange(p, r)
+		}
+		if err := p.SetValue(data, min+rng.Intn(max-min+1)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// DeriveProfile returns profile with ranges covering the values of the
+// example programs
+func DeriveProfile(examples [][]byte) (Profile, error) {
+	pr := Profile{Ranges: map[string]ValueRange{}, Locked: []string{}}
+	if len(examples) == 0 {
+		return pr, fmt.Errorf("no example programs")
+	}
+
+	for _, p := range params {
+		if p.Unit == UnitName {
+			continue
+		}
+		min, max := p.Max, p.Min
+		for _, data := range examples {
+			if _, err := ToProgram(data); err != nil {
+				return pr, err
+			}
+			v := p.Value(data)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		// Examples with values out of parameter range are not used
+		if min < p.Min {
+			min = p.Min
+		}
+		if max > p.Max {
+			max = p.Max
+		}
+		if min > max {
+			continue
+		}
+		pr.Ranges[p.Name] = ValueRange{TextValue(p.Format(min)), TextValue(p.Format(max))}
+	}
+	return pr, nil
+}
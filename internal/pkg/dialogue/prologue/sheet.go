@@ -0,0 +1,108 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import "strings"
+
+// SheetSection is a group of parameters like on the front panel. Timbre
+// sections have the values of main and sub timbre.
+type SheetSection struct {
+	Title  string
+	Timbre bool
+	Rows   []SheetRow
+}
+
+// SheetRow is a parameter with value in text form (main & sub in timbre sections)
+type SheetRow struct {
+	Name   string
+	Values []string
+}
+
+// Front panel sections and the parameters in them (name or prefix ending with '.')
+var panelSections = []struct {
+	title  string
+	timbre bool
+	params []string
+}{
+	{"Program", false, []string{"name", "timbre_type", "main_sub_balance", "split_point", "program_level", "tempo"}},
+	{"Voice", true, []string{"voice_mode", "voice_mode_depth", "portamento"}},
+	{"VCO 1", true, []string{"vco1."}},
+	{"VCO 2", true, []string{"vco2.", "sync", "ring", "cross_mod_depth"}},
+	{"Multi engine", true, []string{"multi."}},
+	{"Mixer", true, []string{"mixer."}},
+	{"Filter", true, []string{"filter."}},
+	{"Amp EG", true, []string{"amp_eg."}},
+	{"EG", true, []string{"eg."}},
+	{"LFO", true, []string{"lfo."}},
+	{"Mod FX", false, []string{"mod_fx."}},
+	{"Delay / Reverb", false, []string{"delay_reverb."}},
+	{"Arpeggiator", false, []string{"arp."}},
+}
+
+var upperWords = map[string]bool{"vco1": true, "vco2": true, "vpm": true, "eg": true, "lfo": true, "fx": true}
+
+// displayName returns readable name of parameter name without group
+// (e.g. "shape_vpm" -> "Shape VPM")
+func displayName(name string) string {
+	words := strings.Split(name, "_")
+	for i, w := range words {
+		switch {
+		case upperWords[w]:
+			words[i] = strings.ToUpper(w)
+		case i == 0:
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Sheet returns parameters of program grouped like the front panel
+func Sheet(data []byte) ([]SheetSection, error) {
+	if _, err := ToProgram(data); err != nil {
+		return nil, err
+	}
+
+	var sections []SheetSection
+	for _, ps := range panelSections {
+		s := SheetSection{Title: ps.title, Timbre: ps.timbre}
+		for _, name := range ps.params {
+			for _, p := range params {
+				key := p.Name
+				if ps.timbre {
+					if !strings.HasPrefix(key, "main.") {
+						continue
+					}
+					key = strings.TrimPrefix(key, "main.")
+				}
+				if key != name && !(strings.HasSuffix(name, ".") && strings.HasPrefix(key, name)) {
+					continue
+				}
+
+				row := SheetRow{Name: displayName(key[strings.LastIndex(key, ".")+1:])}
+				row.Values = append(row.Values, p.Text(data))
+				if ps.timbre {
+					sub, _ := FindParam("sub." + key)
+					row.Values = append(row.Values, sub.Text(data))
+				}
+				s.Rows = append(s.Rows, row)
+			}
+		}
+		sections = append(sections, s)
+	}
+	return sections, nil
+}
@@ -0,0 +1,466 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Program in text form is a mapping of named parameters (see Params) grouped
+// by their path, e.g.
+//
+//   name: Init Program
+//   main:
+//     filter:
+//       cutoff: 1023
+//
+// Bytes not covered by the parameters are in 'unknown' as hex, keyed by offset.
+// Optional metadata of the program (e.g. programmer) is in 'info'.
+
+// unknownKey holds bytes not covered by parameters
+const unknownKey = "unknown"
+
+// infoKey holds metadata of program
+const infoKey = "info"
+
+// Text formats
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+type node struct {
+	key      string
+	value    string
+	quote    bool // Value is a string
+	children []*node
+}
+
+func (n *node) child(key string) *node {
+	if len(n.children) > 0 && n.children[len(n.children)-1].key == key {
+		return n.children[len(n.children)-1]
+	}
+	c := &node{key: key}
+	n.children = append(n.children, c)
+	return c
+}
+
+// Export writes program data in text form (FormatYAML or FormatJSON)
+func Export(w io.Writer, data []byte, format string) error {
+	return ExportInfo(w, data, nil, format)
+}
+
+// ExportInfo writes program data with metadata in text form. Empty
+// metadata values are left out.
+func ExportInfo(w io.Writer, data []byte, info map[string]string, format string) error {
+	if _, err := ToProgram(data); err != nil {
+		return err
+	}
+
+	root := &node{}
+	var keys []string
+	for k, v := range info {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		n := root.child(infoKey)
+		for _, k := range keys {
+			n.children = append(n.children, &node{key: k, value: info[k], quote: true})
+		}
+	}
+
+	for _, p := range params {
+		n := root
+		for _, key := range strings.Split(p.Name, ".") {
+			n = n.child(key)
+		}
+		n.value = p.Text(data)
+		n.quote = p.Unit != UnitNumber && p.Unit != UnitBipolar && p.Unit != UnitTempo
+	}
+
+	unknown := root.child(unknownKey)
+	for _, r := range unknownRanges() {
+		unknown.children = append(unknown.children, &node{
+			key:   strconv.Itoa(r[0]),
+			value: hex.EncodeToString(data[r[0]:r[1]]),
+			quote: true,
+		})
+	}
+
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatYAML:
+		writeYAML(bw, root, 0)
+	case FormatJSON:
+		writeJSON(bw, root, 0)
+		bw.WriteString("\n")
+	default:
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+	return bw.Flush()
+}
+
+// Import reads program in text form (YAML or JSON) and returns program data.
+// All parameters must be present and in range.
+func Import(r io.Reader) ([]byte, error) {
+	data, _, err := ImportInfo(r)
+	return data, err
+}
+
+// ImportInfo reads program in text form and returns program data and
+// metadata
+func ImportInfo(r io.Reader) ([]byte, map[string]string, error) {
+	text, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]string{}
+	if bytes.HasPrefix(bytes.TrimSpace(text), []byte("{")) {
+		err = readJSON(text, values)
+	} else {
+		err = readYAML(text, values)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := make([]byte, ProgramSize)
+	copy(data, programMagic)
+
+	for _, p := range params {
+		s, ok := values[p.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is missing", p.Name)
+		}
+		delete(values, p.Name)
+		if err := p.SetText(data, s); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, r := range unknownRanges() {
+		key := fmt.Sprintf("%s.%d", unknownKey, r[0])
+		s, ok := values[key]
+		if !ok {
+			continue
+		}
+		delete(values, key)
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) != r[1]-r[0] {
+			return nil, nil, fmt.Errorf("%s: expected %d bytes as hex", key, r[1]-r[0])
+		}
+		copy(data[r[0]:], b)
+	}
+
+	info := map[string]string{}
+	for k, v := range values {
+		if strings.HasPrefix(k, infoKey+".") {
+			info[strings.TrimPrefix(k, infoKey+".")] = v
+			delete(values, k)
+		}
+	}
+
+	if len(values) > 0 {
+		var keys []string
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, nil, fmt.Errorf("unknown parameter '%s'", keys[0])
+	}
+
+	return data, info, nil
+}
+
+// unknownRanges returns [start, end) ranges of bytes not covered by parameters
+func unknownRanges() [][2]int {
+	var known [ProgramSize]bool
+	for i := range programMagic {
+		known[i] = true
+	}
+	for _, p := range params {
+		for i := 0; i < p.Size; i++ {
+			known[p.Offset+i] = true
+		}
+	}
+
+	var ranges [][2]int
+	for i := 0; i < ProgramSize; i++ {
+		if known[i] {
+			continue
+		}
+		start := i
+		for i < ProgramSize && !known[i] {
+			i++
+		}
+		ranges = append(ranges, [2]int{start, i})
+	}
+	return ranges
+}
+
+func writeYAML(w *bufio.Writer, n *node, indent int) {
+	for _, c := range n.children {
+		w.WriteString(strings.Repeat("  ", indent))
+		w.WriteString(yamlKey(c.key))
+		w.WriteString(":")
+		if len(c.children) > 0 {
+			w.WriteString("\n")
+			writeYAML(w, c, indent+1)
+			continue
+		}
+		w.WriteString(" ")
+		if c.quote {
+			w.WriteString(yamlString(c.value))
+		} else {
+			w.WriteString(c.value)
+		}
+		w.WriteString("\n")
+	}
+}
+
+func yamlKey(key string) string {
+	if _, err := strconv.Atoi(key); err == nil {
+		return strconv.Quote(key)
+	}
+	return key
+}
+
+// yamlString quotes string if it would not be read back as the same string
+func yamlString(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s, ":#'\"\\{}[],&*!|>%@`") ||
+		strings.ContainsAny(s[:1], "-?") || !isPrintable(s) {
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func isPrintable(s string) bool {
+	for _, c := range s {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w *bufio.Writer, n *node, indent int) {
+	w.WriteString("{\n")
+	for i, c := range n.children {
+		w.WriteString(strings.Repeat("  ", indent+1))
+		w.WriteString(strconv.Quote(c.key))
+		w.WriteString(": ")
+		if len(c.children) > 0 {
+			writeJSON(w, c, indent+1)
+		} else if c.quote {
+			b, _ := json.Marshal(c.value)
+			w.Write(b)
+		} else {
+			w.WriteString(c.value)
+		}
+		if i < len(n.children)-1 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n")
+	}
+	w.WriteString(strings.Repeat("  ", indent))
+	w.WriteString("}")
+}
+
+func readJSON(text []byte, values map[string]string) error {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	return flattenJSON(doc, "", values)
+}
+
+func flattenJSON(m map[string]interface{}, prefix string, values map[string]string) error {
+	for k, v := range m {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if err := flattenJSON(v, prefix+k+".", values); err != nil {
+				return err
+			}
+		case string:
+			values[prefix+k] = v
+		case json.Number:
+			values[prefix+k] = v.String()
+		default:
+			return fmt.Errorf("%s%s: unsupported value", prefix, k)
+		}
+	}
+	return nil
+}
+
+// readYAML reads the subset of YAML written by Export: nested mappings with
+// scalar values and comments
+func readYAML(text []byte, values map[string]string) error {
+	type level struct {
+		indent int
+		prefix string
+	}
+	stack := []level{{-1, ""}}
+	pendingIndent := false
+
+	for i, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") || content == "---" {
+			continue
+		}
+		indent := len(line) - len(content)
+		if strings.HasPrefix(content, "\t") {
+			return fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+
+		if pendingIndent {
+			if indent <= stack[len(stack)-1].indent {
+				return fmt.Errorf("line %d: expected indented mapping", i+1)
+			}
+			stack[len(stack)-1].indent = indent
+			pendingIndent = false
+		}
+		for len(stack) > 1 && indent < stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		if indent != stack[len(stack)-1].indent && len(stack) > 1 {
+			return fmt.Errorf("line %d: bad indentation", i+1)
+		}
+
+		key, rest, err := splitYAMLKey(content)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", i+1, err)
+		}
+		name := stack[len(stack)-1].prefix + key
+
+		value, err := yamlValue(rest)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", i+1, err)
+		}
+		if value == "" && !strings.HasPrefix(strings.TrimSpace(rest), "\"") && !strings.HasPrefix(strings.TrimSpace(rest), "'") {
+			// Start of nested mapping
+			stack = append(stack, level{indent, name + "."})
+			pendingIndent = true
+			continue
+		}
+		values[name] = value
+	}
+	return nil
+}
+
+func splitYAMLKey(s string) (string, string, error) {
+	if strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "'") {
+		v, rest, err := yamlQuoted(s)
+		if err != nil {
+			return "", "", err
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("expected ':' after key")
+		}
+		return v, rest[1:], nil
+	}
+
+	i := strings.Index(s, ":")
+	if i < 0 || (i+1 < len(s) && s[i+1] != ' ') {
+		return "", "", fmt.Errorf("expected 'key: value'")
+	}
+	return strings.TrimSpace(s[:i]), s[i+1:], nil
+}
+
+// yamlValue returns scalar value without quotes and comment
+func yamlValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "'") {
+		v, rest, err := yamlQuoted(s)
+		if err != nil {
+			return "", err
+		}
+		rest = strings.TrimSpace(rest)
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected '%s' after string", rest)
+		}
+		return v, nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	if strings.HasPrefix(s, "#") {
+		s = ""
+	}
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") || strings.HasPrefix(s, "- ") {
+		return "", fmt.Errorf("only plain values are supported")
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// yamlQuoted returns value of quoted string at start of s and the rest of s
+func yamlQuoted(s string) (string, string, error) {
+	if s[0] == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), s[i+1:], nil
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,124 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func exportText(t *testing.T, data []byte, info map[string]string, format string) string {
+	var buf bytes.Buffer
+	if err := ExportInfo(&buf, data, info, format); err != nil {
+		t.Fatalf("ExportInfo(%s): %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	dumps := [][]byte{typicalProgram().FromProgram()}
+	for i := 0; i < 50; i++ {
+		// Unknown bytes random, parameters in range
+		data, err := Sanitize(randomDump(rnd))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dumps = append(dumps, data)
+	}
+	info := map[string]string{"programmer": "Me", "comment": "Line 1\nLine \"2\": #3"}
+
+	for i, data := range dumps {
+		for _, format := range []string{FormatYAML, FormatJSON} {
+			text := exportText(t, data, info, format)
+			out, outInfo, err := ImportInfo(strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("Dump %d %s: ImportInfo: %v\n%s", i, format, err, text)
+			}
+			if !bytes.Equal(out, data) {
+				t.Fatalf("Dump %d %s: import differs from exported data\n got %x\nwant %x", i, format, out, data)
+			}
+			if !reflect.DeepEqual(outInfo, info) {
+				t.Errorf("Dump %d %s: info = %q, want %q", i, format, outInfo, info)
+			}
+		}
+	}
+}
+
+// replaceLine replaces the first line of text starting with prefix (after
+// indentation) with line, keeping the indentation
+func replaceLine(t *testing.T, text string, prefix string, line string) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		content := strings.TrimLeft(l, " ")
+		if strings.HasPrefix(content, prefix) {
+			lines[i] = l[:len(l)-len(content)] + line
+			return strings.Join(lines, "\n")
+		}
+	}
+	t.Fatalf("No line '%s' in exported text", prefix)
+	return ""
+}
+
+func TestImportErrors(t *testing.T) {
+	yaml := exportText(t, typicalProgram().FromProgram(), nil, FormatYAML)
+	json := exportText(t, typicalProgram().FromProgram(), nil, FormatJSON)
+
+	tests := []struct {
+		name string
+		text string
+		err  string
+	}{
+		// Malformed
+		{"tab indentation", strings.Replace(yaml, "\n  ", "\n\t", 1), "tabs are not allowed"},
+		{"missing colon", replaceLine(t, yaml, "tempo:", "tempo 120"), "expected 'key: value'"},
+		{"unterminated string", replaceLine(t, yaml, "name:", `name: "Warm`), "unterminated string"},
+		{"text after string", replaceLine(t, yaml, "name:", `name: "Warm" Pad`), "after string"},
+		{"flow sequence", replaceLine(t, yaml, "tempo:", "tempo: [120]"), "only plain values"},
+		{"bad indentation", replaceLine(t, yaml, "cutoff:", "   cutoff: 700"), "bad indentation"},
+		{"empty mapping", yaml + "extra:\nname: X\n", "expected indented mapping"},
+		{"invalid JSON", strings.TrimSuffix(strings.TrimSpace(json), "}"), "unexpected EOF"},
+		{"JSON array", replaceLine(t, json, `"tempo":`, `"tempo": [120],`), "tempo: unsupported value"},
+
+		// Out of range
+		{"value too big", replaceLine(t, yaml, "cutoff:", "cutoff: 1024"), "main.filter.cutoff"},
+		{"negative value", replaceLine(t, yaml, "resonance:", "resonance: -1"), "main.filter.resonance"},
+		{"unknown name", replaceLine(t, yaml, "wave:", "wave: SINE"), "main.vco1.wave"},
+		{"long name", replaceLine(t, yaml, "name:", "name: Much Too Long Name"), "longer than 12"},
+		{"unknown bytes size", replaceLine(t, yaml, `"48":`, `"48": "0000"`), "unknown.48: expected 1 bytes"},
+
+		// Unknown or missing keys
+		{"unknown key", yaml + "volume: 10\n", "unknown parameter 'volume'"},
+		{"unknown nested key", strings.Replace(json, `"tempo"`, `"colour": "red", "tempo"`, 1), "unknown parameter 'colour'"},
+		{"missing parameter", replaceLine(t, yaml, "tempo:", "# no tempo"), "tempo is missing"},
+	}
+
+	for _, test := range tests {
+		_, _, err := ImportInfo(strings.NewReader(test.text))
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error '%v', want '%s'", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// TimbreID selects main or sub timbre
+type TimbreID int
+
+// Timbres of a program
+const (
+	MainTimbre TimbreID = iota
+	SubTimbre
+)
+
+func (t TimbreID) String() string {
+	if t == SubTimbre {
+		return "sub"
+	}
+	return "main"
+}
+
+// BalanceMainOnly is the main/sub balance where only main timbre sounds
+const BalanceMainOnly = 0
+
+// timbreOffset returns offset of timbre in program data
+func timbreOffset(t TimbreID) int {
+	name := "Main"
+	if t == SubTimbre {
+		name = "Sub"
+	}
+	f, _ := reflect.TypeOf(Program{}).FieldByName(name)
+	offset, _ := strconv.Atoi(f.Tag.Get("prog"))
+	return offset
+}
+
+func timbreData(data []byte, t TimbreID) []byte {
+	offset := timbreOffset(t)
+	return data[offset : offset+TimbreSize]
+}
+
+// CopyTimbre returns copy of program with timbre from copied over timbre to
+func CopyTimbre(data []byte, from TimbreID, to TimbreID) ([]byte, error) {
+	if _, err := ToProgram(data); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), data...)
+	copy(timbreData(out, to), timbreData(data, from))
+	return out, nil
+}
+
+// SwapTimbres returns copy of program with main and sub timbres swapped
+func SwapTimbres(data []byte) ([]byte, error) {
+	if _, err := ToProgram(data); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), data...)
+	copy(timbreData(out, MainTimbre), timbreData(data, SubTimbre))
+	copy(timbreData(out, SubTimbre), timbreData(data, MainTimbre))
+	return out, nil
+}
+
+// LayerTimbres returns program a with timbre t of b as sub timbre and
+// timbre type set to layer
+func LayerTimbres(a []byte, b []byte, t TimbreID) ([]byte, error) {
+	if _, err := ToProgram(a); err != nil {
+		return nil, err
+	}
+	if _, err := ToProgram(b); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), a...)
+	copy(timbreData(out, SubTimbre), timbreData(b, t))
+
+	p, _ := FindParam("timbre_type")
+	p.SetValue(out, int(TimbreLayer))
+	return out, nil
+}
+
+// ExtractTimbre returns copy of program with timbre t as main timbre and
+// sub timbre turned off (layer with main/sub balance fully on main), so it
+// sounds like that timbre alone
+func ExtractTimbre(data []byte, t TimbreID) ([]byte, error) {
+	if _, err := ToProgram(data); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), data...)
+	copy(timbreData(out, MainTimbre), timbreData(data, t))
+
+	p, _ := FindParam("timbre_type")
+	p.SetValue(out, int(TimbreLayer))
+	p, _ = FindParam("main_sub_balance")
+	p.SetValue(out, BalanceMainOnly)
+	return out, nil
+}
@@ -0,0 +1,61 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestExtractTimbre(t *testing.T) {
+	src := typicalProgram()
+	src.TimbreType = TimbreSplit
+	src.MainSubBalance = 700
+	src.Sub.Filter.Cutoff = 100
+
+	for _, timbre := range []TimbreID{MainTimbre, SubTimbre} {
+		data, err := ExtractTimbre(src.FromProgram(), timbre)
+		if err != nil {
+			t.Fatalf("ExtractTimbre(%s): %v", timbre, err)
+		}
+		p, err := ToProgram(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := src.Main
+		if timbre == SubTimbre {
+			want = src.Sub
+		}
+		if !reflect.DeepEqual(p.Main, want) {
+			t.Errorf("ExtractTimbre(%s): main timbre is not the extracted timbre", timbre)
+		}
+		if p.TimbreType != TimbreLayer {
+			t.Errorf("ExtractTimbre(%s): timbre type %s, want %s", timbre, p.TimbreType, TimbreLayer)
+		}
+		if p.MainSubBalance != BalanceMainOnly {
+			t.Errorf("ExtractTimbre(%s): main/sub balance %d, want %d", timbre, p.MainSubBalance, BalanceMainOnly)
+		}
+
+		p.Main, p.TimbreType, p.MainSubBalance = src.Main, src.TimbreType, src.MainSubBalance
+		if !bytes.Equal(p.FromProgram(), src.FromProgram()) {
+			t.Errorf("ExtractTimbre(%s): other parameters changed", timbre)
+		}
+	}
+}
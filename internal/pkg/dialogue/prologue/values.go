@@ -0,0 +1,131 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package prologue
+
+import "strconv"
+
+// Switch is an on/off setting
+type Switch byte
+
+// TimbreType defines how main and sub timbres are combined
+type TimbreType byte
+
+// VoiceMode of a timbre
+type VoiceMode byte
+
+// ArpType is the arpeggiator pattern
+type ArpType byte
+
+// Wave of VCO or LFO
+type Wave byte
+
+// Octave of VCO
+type Octave byte
+
+// MultiType is the multi engine oscillator type
+type MultiType byte
+
+// Amount of filter key tracking and velocity sensitivity
+type Amount byte
+
+// EGTarget is the modulation destination of EG
+type EGTarget byte
+
+// LFOMode of LFO
+type LFOMode byte
+
+// LFOTarget is the modulation destination of LFO
+type LFOTarget byte
+
+// ModFXType is the modulation effect type
+type ModFXType byte
+
+// DelayReverbSelect selects delay, reverb or neither
+type DelayReverbSelect byte
+
+// Timbre types
+const (
+	TimbreLayer TimbreType = iota
+	TimbreXfade
+	TimbreSplit
+)
+
+// Multi engine types
+const (
+	MultiNoise MultiType = iota
+	MultiVPM
+	MultiUser
+)
+
+// Modulation effect types
+const (
+	ModFXChorus ModFXType = iota
+	ModFXEnsemble
+	ModFXPhaser
+	ModFXFlanger
+	ModFXUser
+)
+
+// Delay/reverb selections and the first delay and reverb sub types that
+// select a user slot (User1~8)
+const (
+	DelayReverbOff DelayReverbSelect = iota
+	DelayReverbDelay
+	DelayReverbReverb
+
+	DelayUserFirst  = 12
+	ReverbUserFirst = 10
+)
+
+var (
+	switchNames            = []string{"Off", "On"}
+	timbreTypeNames        = []string{"Layer", "Xfade", "Split"}
+	voiceModeNames         = []string{"Poly", "Mono", "Unison", "Chord"}
+	arpTypeNames           = []string{"Up", "Down", "Alt1", "Alt2", "Random"}
+	waveNames              = []string{"SQR", "TRI", "SAW"}
+	octaveNames            = []string{"16'", "8'", "4'", "2'"}
+	multiTypeNames         = []string{"Noise", "VPM", "User"}
+	amountNames            = []string{"0%", "50%", "100%"}
+	egTargetNames          = []string{"Cutoff", "Pitch 2", "Pitch"}
+	lfoModeNames           = []string{"1-Shot", "Normal", "BPM"}
+	lfoTargetNames         = []string{"Cutoff", "Shape", "Pitch"}
+	modFXTypeNames         = []string{"Chorus", "Ensemble", "Phaser", "Flanger", "User"}
+	delayReverbSelectNames = []string{"Off", "Delay", "Reverb"}
+)
+
+// valueName returns name of value or the number if it has no name
+func valueName(names []string, v byte) string {
+	if int(v) < len(names) {
+		return names[v]
+	}
+	return strconv.Itoa(int(v))
+}
+
+func (v Switch) String() string            { return valueName(switchNames, byte(v)) }
+func (v TimbreType) String() string        { return valueName(timbreTypeNames, byte(v)) }
+func (v VoiceMode) String() string         { return valueName(voiceModeNames, byte(v)) }
+func (v ArpType) String() string           { return valueName(arpTypeNames, byte(v)) }
+func (v Wave) String() string              { return valueName(waveNames, byte(v)) }
+func (v Octave) String() string            { return valueName(octaveNames, byte(v)) }
+func (v MultiType) String() string         { return valueName(multiTypeNames, byte(v)) }
+func (v Amount) String() string            { return valueName(amountNames, byte(v)) }
+func (v EGTarget) String() string          { return valueName(egTargetNames, byte(v)) }
+func (v LFOMode) String() string           { return valueName(lfoModeNames, byte(v)) }
+func (v LFOTarget) String() string         { return valueName(lfoTargetNames, byte(v)) }
+func (v ModFXType) String() string         { return valueName(modFXTypeNames, byte(v)) }
+func (v DelayReverbSelect) String() string { return valueName(delayReverbSelectNames, byte(v)) }
@@ -0,0 +1,72 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	prologue "dialogue/internal/pkg/dialogue/prologue"
+)
+
+// LoadProfile reads randomizer profile (JSON)
+func LoadProfile(filename string) (prologue.Profile, error) {
+	var pr prologue.Profile
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return pr, newError(ErrFile, err, "Cannot read profile '%s'", filename)
+	}
+	if err := json.Unmarshal(data, &pr); err != nil {
+		return pr, newError(ErrFile, err, "Cannot parse profile '%s'", filename)
+	}
+	if err := pr.Check(); err != nil {
+		return pr, newError(ErrFile, err, "Invalid profile '%s'", filename)
+	}
+	return pr, nil
+}
+
+// SaveProfile writes randomizer profile (JSON)
+func SaveProfile(filename string, pr prologue.Profile) error {
+	data, err := json.MarshalIndent(pr, "", "  ")
+	if err != nil {
+		return newError(ErrArgument, err, "Cannot encode profile")
+	}
+	if err := ioutil.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return newError(ErrFile, err, "Cannot write profile '%s'", filename)
+	}
+	return nil
+}
+
+// RandomizeProgram returns copy of base program randomized with profile
+func RandomizeProgram(base []byte, pr prologue.Profile, seed int64) ([]byte, error) {
+	data, err := prologue.Randomize(base, pr, seed)
+	if err != nil {
+		return nil, newError(ErrArgument, err, "Cannot randomize program")
+	}
+	return data, nil
+}
+
+// DeriveProfile returns randomizer profile with ranges of example programs
+func DeriveProfile(examples [][]byte) (prologue.Profile, error) {
+	pr, err := prologue.DeriveProfile(examples)
+	if err != nil {
+		return pr, newError(ErrArgument, err, "Cannot derive profile")
+	}
+	return pr, nil
+}
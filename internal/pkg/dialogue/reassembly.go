@@ -0,0 +1,109 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"gitlab.com/gomidi/midi"
+)
+
+// Maximum size of incoming SysEx message (UserSlotData of largest
+// oscillator fits with plenty of room)
+const maxSysexSize = 128 * 1024
+
+// reassemblingIn is a MIDI input that delivers SysEx messages to the
+// listener only when complete. Some drivers and network bridges deliver
+// long SysEx as several partial packets.
+type reassemblingIn struct {
+	midi.In
+	buf      []byte
+	inSysex  bool
+	overflow bool
+}
+
+func newReassemblingIn(in midi.In) *reassemblingIn {
+	return &reassemblingIn{In: in}
+}
+
+func (r *reassemblingIn) SetListener(listener func(data []byte, deltaMicroseconds int64)) error {
+	return r.In.SetListener(func(data []byte, deltaMicroseconds int64) {
+		for _, msg := range r.reassemble(data) {
+			listener(msg, deltaMicroseconds)
+		}
+	})
+}
+
+// reassemble collects SysEx over several packets. Complete SysEx messages and
+// other data are returned in order of arrival.
+func (r *reassemblingIn) reassemble(data []byte) [][]byte {
+	var out [][]byte
+	var other []byte
+
+	flushOther := func() {
+		if len(other) > 0 {
+			out = append(out, other)
+			other = nil
+		}
+	}
+
+	for _, b := range data {
+		switch {
+		case b == 0xF0:
+			if r.inSysex {
+				logf(LogDebug, "Unterminated SysEx (%d bytes) discarded", len(r.buf))
+			}
+			flushOther()
+			r.buf = append(r.buf[:0], b)
+			r.inSysex = true
+			r.overflow = false
+
+		case !r.inSysex:
+			other = append(other, b)
+
+		case b == 0xF7:
+			r.inSysex = false
+			if r.overflow {
+				logf(LogError, "Incoming SysEx exceeds maximum size (%d bytes)!", maxSysexSize)
+				continue
+			}
+			msg := make([]byte, len(r.buf)+1)
+			copy(msg, r.buf)
+			msg[len(r.buf)] = b
+			out = append(out, msg)
+
+		case b >= 0xF8:
+			// Real-time messages interleaved with SysEx are discarded
+
+		case b >= 0x80:
+			// Any other status byte ends SysEx without F7
+			r.inSysex = false
+			other = append(other, b)
+
+		case len(r.buf) >= maxSysexSize:
+			r.overflow = true
+
+		default:
+			r.buf = append(r.buf, b)
+			if len(r.buf)%progressReceiveStep == 0 {
+				reportProgress(PhaseReceive, len(r.buf), 0)
+			}
+		}
+	}
+	flushOther()
+
+	return out
+}
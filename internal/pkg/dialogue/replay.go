@@ -0,0 +1,168 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"gitlab.com/gomidi/midi"
+)
+
+// replayDevice is a fake device answering to sent SysEx with the messages
+// received after it in a capture
+type replayDevice struct {
+	name     string
+	mu       sync.Mutex
+	entries  []CaptureEntry
+	pos      int
+	buf      []byte
+	listener func(data []byte, deltaMicroseconds int64)
+}
+
+// Replay capture file (made with StartCapture) instead of real device
+func setReplayMidi(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return newError(ErrFile, err, "Cannot open capture file '%s'", filename)
+	}
+	defer f.Close()
+
+	entries, err := ReadCapture(f)
+	if err != nil {
+		return err
+	}
+
+	d := &replayDevice{name: filename, entries: entries}
+	midiConn.in, midiConn.out = &replayIn{replayPort{d: d}}, &replayOut{replayPort{d: d}}
+	midiConn.partialSysex = true
+	if midiConn.ch == nil {
+		midiConn.ch = make(chan []byte, 1)
+	}
+
+	return listenMidi()
+}
+
+// receive collects SysEx written to device and replies when complete.
+// Other messages are ignored.
+func (d *replayDevice) receive(data []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, b := range data {
+		switch {
+		case b == 0xF0:
+			d.buf = append(d.buf[:0], b)
+		case len(d.buf) == 0:
+		case b == 0xF7:
+			d.reply(append(d.buf, b))
+			d.buf = d.buf[:0]
+		default:
+			d.buf = append(d.buf, b)
+		}
+	}
+}
+
+// reply sends messages received after next sent message in capture
+func (d *replayDevice) reply(msg []byte) {
+	for d.pos < len(d.entries) && d.entries[d.pos].Direction != DirectionSent {
+		d.pos++
+	}
+	if d.pos == len(d.entries) {
+		logf(LogWarning, "Replay: no more messages in capture")
+		return
+	}
+	if !bytes.Equal(msg, d.entries[d.pos].Data) {
+		logf(LogWarning, "Replay: sent SysEx differs from capture (entry %d)", d.pos+1)
+	}
+	d.pos++
+
+	var replies [][]byte
+	for ; d.pos < len(d.entries) && d.entries[d.pos].Direction == DirectionReceived; d.pos++ {
+		replies = append(replies, d.entries[d.pos].Data)
+	}
+
+	listener := d.listener
+	if listener == nil {
+		return
+	}
+	go func() {
+		for _, r := range replies {
+			listener(r, 0)
+		}
+	}()
+}
+
+// replayPort implements the common part of gomidi's midi.Port
+type replayPort struct {
+	d    *replayDevice
+	open bool
+}
+
+func (p *replayPort) Open() error {
+	p.open = true
+	return nil
+}
+
+func (p *replayPort) Close() error {
+	p.open = false
+	return nil
+}
+
+func (p *replayPort) IsOpen() bool { return p.open }
+
+func (p *replayPort) Number() int { return 0 }
+
+func (p *replayPort) String() string { return fmt.Sprintf("replay: %s", p.d.name) }
+
+func (p *replayPort) Underlying() interface{} { return p.d }
+
+type replayIn struct {
+	replayPort
+}
+
+func (i *replayIn) SetListener(listener func(data []byte, deltaMicroseconds int64)) error {
+	if !i.open {
+		return midi.ErrPortClosed
+	}
+	i.d.mu.Lock()
+	i.d.listener = listener
+	i.d.mu.Unlock()
+	return nil
+}
+
+func (i *replayIn) StopListening() error {
+	i.d.mu.Lock()
+	i.d.listener = nil
+	i.d.mu.Unlock()
+	return nil
+}
+
+type replayOut struct {
+	replayPort
+}
+
+func (o *replayOut) Write(b []byte) (int, error) {
+	if !o.open {
+		return 0, midi.ErrPortClosed
+	}
+	o.d.receive(b)
+	return len(b), nil
+}
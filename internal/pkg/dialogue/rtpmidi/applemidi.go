@@ -0,0 +1,112 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package rtpmidi
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// AppleMIDI session protocol packets start with 0xFFFF signature
+const signature uint16 = 0xFFFF
+
+const protocolVersion uint32 = 2
+
+// AppleMIDI commands
+const (
+	cmdInvitation         = "IN"
+	cmdInvitationAccepted = "OK"
+	cmdInvitationRejected = "NO"
+	cmdBye                = "BY"
+	cmdClockSync          = "CK"
+)
+
+// command is an invitation / end of session packet
+type command struct {
+	cmd     string
+	version uint32
+	token   uint32
+	ssrc    uint32
+	name    string
+}
+
+func (c command) marshal() []byte {
+	buf := make([]byte, 16, 16+len(c.name)+1)
+	binary.BigEndian.PutUint16(buf[0:2], signature)
+	copy(buf[2:4], c.cmd)
+	binary.BigEndian.PutUint32(buf[4:8], c.version)
+	binary.BigEndian.PutUint32(buf[8:12], c.token)
+	binary.BigEndian.PutUint32(buf[12:16], c.ssrc)
+	if c.cmd != cmdBye {
+		buf = append(buf, c.name...)
+		buf = append(buf, 0x00)
+	}
+	return buf
+}
+
+func parseCommand(packet []byte) (command, bool) {
+	if len(packet) < 16 || binary.BigEndian.Uint16(packet[0:2]) != signature {
+		return command{}, false
+	}
+	c := command{cmd: string(packet[2:4])}
+	switch c.cmd {
+	case cmdInvitation, cmdInvitationAccepted, cmdInvitationRejected, cmdBye:
+	default:
+		return command{}, false
+	}
+	c.version = binary.BigEndian.Uint32(packet[4:8])
+	c.token = binary.BigEndian.Uint32(packet[8:12])
+	c.ssrc = binary.BigEndian.Uint32(packet[12:16])
+	c.name = string(bytes.TrimRight(packet[16:], "\x00"))
+	return c, true
+}
+
+// clockSync is a three-way timestamp exchange (count 0, 1 & 2)
+type clockSync struct {
+	ssrc       uint32
+	count      byte
+	timestamps [3]uint64
+}
+
+func (cs clockSync) marshal() []byte {
+	buf := make([]byte, 36)
+	binary.BigEndian.PutUint16(buf[0:2], signature)
+	copy(buf[2:4], cmdClockSync)
+	binary.BigEndian.PutUint32(buf[4:8], cs.ssrc)
+	buf[8] = cs.count
+	for i, ts := range cs.timestamps {
+		binary.BigEndian.PutUint64(buf[12+i*8:20+i*8], ts)
+	}
+	return buf
+}
+
+func parseClockSync(packet []byte) (clockSync, bool) {
+	if len(packet) < 36 || binary.BigEndian.Uint16(packet[0:2]) != signature || string(packet[2:4]) != cmdClockSync {
+		return clockSync{}, false
+	}
+	cs := clockSync{}
+	cs.ssrc = binary.BigEndian.Uint32(packet[4:8])
+	cs.count = packet[8]
+	if cs.count > 2 {
+		return clockSync{}, false
+	}
+	for i := range cs.timestamps {
+		cs.timestamps[i] = binary.BigEndian.Uint64(packet[12+i*8 : 20+i*8])
+	}
+	return cs, true
+}
@@ -0,0 +1,119 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package rtpmidi
+
+import (
+	"fmt"
+	"sync"
+
+	"gitlab.com/gomidi/midi"
+)
+
+// port implements the common part of gomidi's midi.Port for a session
+type port struct {
+	s    *Session
+	mu   sync.Mutex
+	open bool
+}
+
+func (p *port) Open() error {
+	p.mu.Lock()
+	p.open = true
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *port) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.open
+}
+
+func (p *port) Number() int { return 0 }
+
+func (p *port) String() string {
+	if name := p.s.RemoteName(); name != "" {
+		return fmt.Sprintf("rtpmidi: %s", name)
+	}
+	return fmt.Sprintf("rtpmidi: %s", p.s.Addr())
+}
+
+func (p *port) Underlying() interface{} { return p.s }
+
+type inPort struct {
+	port
+}
+
+// In returns the session as gomidi input port
+func (s *Session) In() midi.In {
+	return &inPort{port{s: s}}
+}
+
+func (i *inPort) SetListener(listener func(data []byte, deltaMicroseconds int64)) error {
+	if !i.IsOpen() {
+		return midi.ErrPortClosed
+	}
+	i.s.mu.Lock()
+	defer i.s.mu.Unlock()
+	if i.s.listener != nil {
+		return fmt.Errorf("listener already set")
+	}
+	i.s.listener = listener
+	return nil
+}
+
+func (i *inPort) StopListening() error {
+	i.s.mu.Lock()
+	i.s.listener = nil
+	i.s.mu.Unlock()
+	return nil
+}
+
+func (i *inPort) Close() error {
+	i.StopListening()
+	i.mu.Lock()
+	i.open = false
+	i.mu.Unlock()
+	return nil
+}
+
+type outPort struct {
+	port
+}
+
+// Out returns the session as gomidi output port
+func (s *Session) Out() midi.Out {
+	return &outPort{port{s: s}}
+}
+
+func (o *outPort) Write(b []byte) (int, error) {
+	if !o.IsOpen() {
+		return 0, midi.ErrPortClosed
+	}
+	if err := o.s.Send(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (o *outPort) Close() error {
+	o.mu.Lock()
+	o.open = false
+	o.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,326 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package rtpmidi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// RTP payload type used by AppleMIDI
+const payloadType byte = 0x61
+
+// Maximum SysEx bytes in one RTP packet. Longer SysEx messages are segmented.
+const maxSysexSegment = 1000
+
+// MIDI command section header flags (RFC 6295)
+const (
+	flagLongHeader byte = 0x80 // B: 12-bit length
+	flagJournal    byte = 0x40 // J: journal section present
+	flagFirstDelta byte = 0x20 // Z: first command has delta time
+	flagPhantom    byte = 0x10 // P: status byte of first command omitted
+)
+
+// Send writes MIDI bytes to the remote participant. SysEx may be split over
+// several calls, it is sent when the end of SysEx has been written.
+func (s *Session) Send(b []byte) error {
+	s.mu.Lock()
+	remote := s.remoteData
+	msgs, rest := splitMessages(append(s.pending, b...))
+	s.pending = rest
+	s.mu.Unlock()
+
+	if remote == nil {
+		return fmt.Errorf("no participant in session")
+	}
+
+	for _, msg := range msgs {
+		for _, cmd := range segment(msg) {
+			if _, err := s.data.WriteToUDP(s.packet(cmd), remote); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// packet wraps one MIDI command into RTP MIDI packet
+func (s *Session) packet(cmd []byte) []byte {
+	s.mu.Lock()
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	buf := make([]byte, 12, 14+len(cmd))
+	buf[0] = 0x80 // Version 2
+	buf[1] = payloadType
+	binary.BigEndian.PutUint16(buf[2:4], seq)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(s.timestamp()))
+	binary.BigEndian.PutUint32(buf[8:12], s.ssrc)
+
+	if len(cmd) > 0x0F {
+		buf = append(buf, flagLongHeader|byte(len(cmd)>>8), byte(len(cmd)))
+	} else {
+		buf = append(buf, byte(len(cmd)))
+	}
+	return append(buf, cmd...)
+}
+
+// segment splits long SysEx into RTP MIDI SysEx segments (F0..F0, F7..F0, F7..F7)
+func segment(msg []byte) [][]byte {
+	if len(msg) <= maxSysexSegment || msg[0] != 0xF0 {
+		return [][]byte{msg}
+	}
+
+	body := msg[1 : len(msg)-1]
+	var segments [][]byte
+
+	for start := 0; start < len(body); start += maxSysexSegment {
+		end := start + maxSysexSegment
+		if end > len(body) {
+			end = len(body)
+		}
+		first, last := byte(0xF7), byte(0xF0)
+		if start == 0 {
+			first = 0xF0
+		}
+		if end == len(body) {
+			last = 0xF7
+		}
+		seg := make([]byte, 0, end-start+2)
+		seg = append(seg, first)
+		seg = append(seg, body[start:end]...)
+		seg = append(seg, last)
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+// splitMessages splits MIDI byte stream into complete messages and returns
+// unfinished SysEx as rest. A SysEx start inside SysEx restarts it and a
+// stray SysEx end is dropped.
+func splitMessages(b []byte) (msgs [][]byte, rest []byte) {
+	var running byte
+
+	for i := 0; i < len(b); {
+		status := b[i]
+
+		switch {
+		case status == 0xF0:
+			end := i + 1
+			for end < len(b) && b[end] != 0xF7 {
+				if b[end] == 0xF0 {
+					i = end
+				}
+				end++
+			}
+			if end == len(b) {
+				return msgs, append([]byte(nil), b[i:]...)
+			}
+			msgs = append(msgs, b[i:end+1])
+			i = end + 1
+			running = 0
+
+		case status < 0x80:
+			if running == 0 {
+				i++
+				continue
+			}
+			n := messageLength(running) - 1
+			if i+n > len(b) {
+				return msgs, nil
+			}
+			msgs = append(msgs, append([]byte{running}, b[i:i+n]...))
+			i += n
+
+		default:
+			n := messageLength(status)
+			if n == 0 || i+n > len(b) {
+				i++
+				continue
+			}
+			msgs = append(msgs, b[i:i+n])
+			i += n
+			if status < 0xF0 {
+				running = status
+			} else if status < 0xF8 {
+				running = 0
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// messageLength returns length of non-SysEx message by its status byte
+func messageLength(status byte) int {
+	switch {
+	case status >= 0x80 && status < 0xC0, status >= 0xE0 && status < 0xF0:
+		return 3
+	case status >= 0xC0 && status < 0xE0:
+		return 2
+	case status == 0xF1 || status == 0xF3:
+		return 2
+	case status == 0xF2:
+		return 3
+	case status == 0xF6 || status >= 0xF8:
+		return 1
+	}
+	return 0
+}
+
+// handleRTP parses RTP MIDI packet and passes its commands to the listener
+func (s *Session) handleRTP(packet []byte) {
+	if len(packet) < 13 || packet[0]>>6 != 2 || packet[1]&0x7F != payloadType {
+		return
+	}
+	s.mu.Lock()
+	remoteSSRC := s.remoteSSRC
+	s.mu.Unlock()
+	if binary.BigEndian.Uint32(packet[8:12]) != remoteSSRC {
+		return
+	}
+
+	pos := 12 + 4*int(packet[0]&0x0F)
+	if packet[0]&0x10 != 0 {
+		if pos+4 > len(packet) {
+			return
+		}
+		pos += 4 + 4*int(binary.BigEndian.Uint16(packet[pos+2:pos+4]))
+	}
+	if pos >= len(packet) {
+		return
+	}
+
+	flags := packet[pos]
+	length := int(flags & 0x0F)
+	pos++
+	if flags&flagLongHeader != 0 {
+		if pos >= len(packet) {
+			return
+		}
+		length = length<<8 | int(packet[pos])
+		pos++
+	}
+	if pos+length > len(packet) {
+		return
+	}
+
+	s.parseCommandList(packet[pos:pos+length], flags&flagFirstDelta != 0)
+}
+
+func (s *Session) parseCommandList(list []byte, firstDelta bool) {
+	var running byte
+
+	for pos := 0; pos < len(list); {
+		if pos > 0 || firstDelta {
+			for pos < len(list) && list[pos] >= 0x80 {
+				pos++
+			}
+			pos++
+		}
+		if pos >= len(list) {
+			return
+		}
+
+		status := list[pos]
+		switch {
+		case status == 0xF0 || status == 0xF7:
+			end := pos + 1
+			for end < len(list) && list[end] < 0x80 {
+				end++
+			}
+			if end == len(list) {
+				return
+			}
+			s.sysexSegment(list[pos : end+1])
+			pos = end + 1
+
+		case status < 0x80:
+			if running == 0 {
+				return
+			}
+			n := messageLength(running) - 1
+			if pos+n > len(list) {
+				return
+			}
+			s.deliver(append([]byte{running}, list[pos:pos+n]...))
+			pos += n
+
+		default:
+			n := messageLength(status)
+			if n == 0 || pos+n > len(list) {
+				return
+			}
+			s.deliver(list[pos : pos+n])
+			pos += n
+			if status < 0xF0 {
+				running = status
+			} else if status < 0xF8 {
+				running = 0
+			}
+		}
+	}
+}
+
+// sysexSegment collects SysEx segments and delivers the complete message
+func (s *Session) sysexSegment(seg []byte) {
+	first, last := seg[0], seg[len(seg)-1]
+	data := seg[1 : len(seg)-1]
+
+	s.mu.Lock()
+	switch {
+	case last == 0xF4: // Cancelled
+		s.sysexBuf = nil
+		s.mu.Unlock()
+		return
+	case first == 0xF0:
+		s.sysexBuf = append([]byte{0xF0}, data...)
+	case s.sysexBuf != nil:
+		s.sysexBuf = append(s.sysexBuf, data...)
+	default: // Continuation without start
+		s.mu.Unlock()
+		return
+	}
+
+	if last != 0xF7 {
+		s.mu.Unlock()
+		return
+	}
+	msg := append(s.sysexBuf, 0xF7)
+	s.sysexBuf = nil
+	s.mu.Unlock()
+
+	s.deliver(msg)
+}
+
+func (s *Session) deliver(msg []byte) {
+	s.mu.Lock()
+	listener := s.listener
+	now := time.Now()
+	var delta int64
+	if !s.lastRecv.IsZero() {
+		delta = int64(now.Sub(s.lastRecv) / time.Microsecond)
+	}
+	s.lastRecv = now
+	s.mu.Unlock()
+
+	if listener != nil {
+		listener(append([]byte(nil), msg...), delta)
+	}
+}
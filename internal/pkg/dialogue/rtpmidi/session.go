@@ -0,0 +1,362 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package rtpmidi
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Session is an AppleMIDI (RTP-MIDI) session with one remote participant.
+// Session uses two UDP sockets: control (invitations, end of session) and
+// data (clock sync & RTP MIDI packets).
+type Session struct {
+	name  string
+	ssrc  uint32
+	token uint32
+	start time.Time
+
+	ctrl *net.UDPConn
+	data *net.UDPConn
+
+	mu         sync.Mutex
+	remoteCtrl *net.UDPAddr
+	remoteData *net.UDPAddr
+	remoteSSRC uint32
+	remoteName string
+	joined     chan struct{}
+	seq        uint16
+	latency    time.Duration
+	listener   func(data []byte, deltaMicroseconds int64)
+	lastRecv   time.Time
+	sysexBuf   []byte
+	pending    []byte
+
+	closed chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Number of invitation attempts before giving up
+const inviteRetries = 12
+
+// Interval of clock synchronization after the session is established
+const syncInterval = 10 * time.Second
+
+func newSession(name string) *Session {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &Session{
+		name:   name,
+		ssrc:   rnd.Uint32(),
+		token:  rnd.Uint32(),
+		start:  time.Now(),
+		joined: make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+// Dial invites the remote session at address (host:port of control port)
+// and returns when both control and data port invitations are accepted.
+func Dial(address string, name string) (*Session, error) {
+	remote, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve '%s': %v", address, err)
+	}
+
+	s := newSession(name)
+	s.remoteCtrl = remote
+	s.remoteData = &net.UDPAddr{IP: remote.IP, Port: remote.Port + 1, Zone: remote.Zone}
+
+	if s.ctrl, err = net.ListenUDP("udp", nil); err != nil {
+		return nil, err
+	}
+	if s.data, err = net.ListenUDP("udp", nil); err != nil {
+		s.ctrl.Close()
+		return nil, err
+	}
+
+	if err = s.invite(s.ctrl, s.remoteCtrl); err != nil {
+		s.closeSockets()
+		return nil, err
+	}
+	if err = s.invite(s.data, s.remoteData); err != nil {
+		s.sendControl(s.ctrl, s.remoteCtrl, command{cmd: cmdBye, version: protocolVersion, token: s.token, ssrc: s.ssrc})
+		s.closeSockets()
+		return nil, err
+	}
+	close(s.joined)
+
+	s.wg.Add(3)
+	go s.serve(s.ctrl)
+	go s.serve(s.data)
+	go s.syncLoop()
+
+	return s, nil
+}
+
+// Listen opens a session at address (host:port of control port, data port is
+// port+1) and waits in the background for a remote participant to join.
+func Listen(address string, name string) (*Session, error) {
+	local, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve '%s': %v", address, err)
+	}
+
+	s := newSession(name)
+
+	if s.ctrl, err = net.ListenUDP("udp", local); err != nil {
+		return nil, err
+	}
+	dataAddr := &net.UDPAddr{IP: local.IP, Port: s.ctrl.LocalAddr().(*net.UDPAddr).Port + 1, Zone: local.Zone}
+	if s.data, err = net.ListenUDP("udp", dataAddr); err != nil {
+		s.ctrl.Close()
+		return nil, err
+	}
+
+	s.wg.Add(2)
+	go s.serve(s.ctrl)
+	go s.serve(s.data)
+
+	return s, nil
+}
+
+// Addr returns the local control port address of the session
+func (s *Session) Addr() net.Addr {
+	return s.ctrl.LocalAddr()
+}
+
+// Joined is closed when a remote participant has joined the session
+func (s *Session) Joined() <-chan struct{} {
+	return s.joined
+}
+
+// RemoteName returns the session name of the remote participant
+func (s *Session) RemoteName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remoteName
+}
+
+// Latency returns the one-way latency measured by the latest clock sync
+func (s *Session) Latency() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latency
+}
+
+// Close ends the session and releases the sockets
+func (s *Session) Close() error {
+	select {
+	case <-s.closed:
+		return nil
+	default:
+	}
+
+	s.mu.Lock()
+	remote := s.remoteCtrl
+	s.mu.Unlock()
+
+	if remote != nil {
+		s.sendControl(s.ctrl, remote, command{cmd: cmdBye, version: protocolVersion, token: s.token, ssrc: s.ssrc})
+	}
+
+	close(s.closed)
+	s.closeSockets()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Session) closeSockets() {
+	s.ctrl.Close()
+	s.data.Close()
+}
+
+// timestamp returns session time in 100 microsecond units
+func (s *Session) timestamp() uint64 {
+	return uint64(time.Since(s.start) / (100 * time.Microsecond))
+}
+
+func (s *Session) sendControl(conn *net.UDPConn, addr *net.UDPAddr, c command) error {
+	_, err := conn.WriteToUDP(c.marshal(), addr)
+	return err
+}
+
+func (s *Session) invite(conn *net.UDPConn, addr *net.UDPAddr) error {
+	in := command{cmd: cmdInvitation, version: protocolVersion, token: s.token, ssrc: s.ssrc, name: s.name}
+	buf := make([]byte, 1500)
+
+	for i := 0; i < inviteRetries; i++ {
+		if err := s.sendControl(conn, addr, in); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		c, ok := parseCommand(buf[:n])
+		if !ok || c.token != s.token {
+			continue
+		}
+		switch c.cmd {
+		case cmdInvitationAccepted:
+			s.mu.Lock()
+			s.remoteSSRC = c.ssrc
+			s.remoteName = c.name
+			s.mu.Unlock()
+			conn.SetReadDeadline(time.Time{})
+			return nil
+		case cmdInvitationRejected:
+			return fmt.Errorf("invitation rejected by %s", addr)
+		}
+	}
+	return fmt.Errorf("no answer from %s", addr)
+}
+
+// serve handles incoming packets of one socket until the session is closed
+func (s *Session) serve(conn *net.UDPConn) {
+	defer s.wg.Done()
+	buf := make([]byte, 65536)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.closed:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		packet := buf[:n]
+
+		if c, ok := parseCommand(packet); ok {
+			s.handleCommand(conn, addr, c)
+			continue
+		}
+		if cs, ok := parseClockSync(packet); ok {
+			s.handleClockSync(conn, addr, cs)
+			continue
+		}
+		if conn == s.data {
+			s.handleRTP(packet)
+		}
+	}
+}
+
+func (s *Session) handleCommand(conn *net.UDPConn, addr *net.UDPAddr, c command) {
+	switch c.cmd {
+	case cmdInvitation:
+		s.mu.Lock()
+		if s.remoteSSRC != 0 && s.remoteSSRC != c.ssrc {
+			s.mu.Unlock()
+			s.sendControl(conn, addr, command{cmd: cmdInvitationRejected, version: protocolVersion, token: c.token, ssrc: s.ssrc})
+			return
+		}
+		s.remoteSSRC = c.ssrc
+		s.remoteName = c.name
+		joined := false
+		if conn == s.ctrl {
+			s.remoteCtrl = addr
+		} else {
+			s.remoteData = addr
+			joined = s.remoteCtrl != nil
+		}
+		s.mu.Unlock()
+
+		s.sendControl(conn, addr, command{cmd: cmdInvitationAccepted, version: protocolVersion, token: c.token, ssrc: s.ssrc, name: s.name})
+
+		if joined {
+			select {
+			case <-s.joined:
+			default:
+				close(s.joined)
+			}
+		}
+
+	case cmdBye:
+		s.mu.Lock()
+		if c.ssrc == s.remoteSSRC {
+			s.remoteCtrl, s.remoteData, s.remoteSSRC, s.remoteName = nil, nil, 0, ""
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Session) handleClockSync(conn *net.UDPConn, addr *net.UDPAddr, cs clockSync) {
+	now := s.timestamp()
+
+	switch cs.count {
+	case 0:
+		cs.count = 1
+		cs.timestamps[1] = now
+		cs.ssrc = s.ssrc
+		conn.WriteToUDP(cs.marshal(), addr)
+	case 1:
+		cs.count = 2
+		cs.timestamps[2] = now
+		cs.ssrc = s.ssrc
+		conn.WriteToUDP(cs.marshal(), addr)
+		s.setLatency((cs.timestamps[2] - cs.timestamps[0]) / 2)
+	case 2:
+		s.setLatency((cs.timestamps[2] - cs.timestamps[0]) / 2)
+	}
+}
+
+func (s *Session) setLatency(ticks uint64) {
+	s.mu.Lock()
+	s.latency = time.Duration(ticks) * 100 * time.Microsecond
+	s.mu.Unlock()
+}
+
+// syncLoop starts clock synchronization periodically (initiator only)
+func (s *Session) syncLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	s.startClockSync()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.startClockSync()
+		}
+	}
+}
+
+func (s *Session) startClockSync() {
+	s.mu.Lock()
+	remote := s.remoteData
+	s.mu.Unlock()
+	if remote == nil {
+		return
+	}
+	cs := clockSync{ssrc: s.ssrc, count: 0}
+	cs.timestamps[0] = s.timestamp()
+	s.data.WriteToUDP(cs.marshal(), remote)
+}
@@ -0,0 +1,138 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package rtpmidi
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it is true or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// loopback returns a listening session and a session dialed to it
+func loopback(t *testing.T) (*Session, *Session) {
+	var listener *Session
+	var err error
+	// Data port (control port + 1) may be taken, try another port
+	for i := 0; i < 5; i++ {
+		if listener, err = Listen("127.0.0.1:0", "listener"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	dialer, err := Dial(listener.Addr().String(), "dialer")
+	if err != nil {
+		listener.Close()
+		t.Fatalf("Dial: %v", err)
+	}
+	return listener, dialer
+}
+
+func TestInvitation(t *testing.T) {
+	listener, dialer := loopback(t)
+	defer listener.Close()
+	defer dialer.Close()
+
+	select {
+	case <-listener.Joined():
+	case <-time.After(time.Second):
+		t.Fatal("Listener was not joined")
+	}
+	if name := listener.RemoteName(); name != "dialer" {
+		t.Errorf("Listener's remote name = '%s', want 'dialer'", name)
+	}
+	if name := dialer.RemoteName(); name != "listener" {
+		t.Errorf("Dialer's remote name = '%s', want 'listener'", name)
+	}
+}
+
+func TestClockSync(t *testing.T) {
+	listener, dialer := loopback(t)
+	defer listener.Close()
+	defer dialer.Close()
+	<-listener.Joined()
+
+	// Latency on loopback may round to 0, so start from a value sync replaces
+	const unsynced = time.Hour
+	dialer.setLatency(uint64(unsynced / (100 * time.Microsecond)))
+	listener.setLatency(uint64(unsynced / (100 * time.Microsecond)))
+
+	dialer.startClockSync()
+	waitFor(t, "dialer's clock sync (count 1)", func() bool { return dialer.Latency() < unsynced })
+	waitFor(t, "listener's clock sync (count 2)", func() bool { return listener.Latency() < unsynced })
+}
+
+func TestSysexRoundTrip(t *testing.T) {
+	listener, dialer := loopback(t)
+	defer listener.Close()
+	defer dialer.Close()
+	<-listener.Joined()
+
+	// Listener echoes messages back, dialer collects them
+	listenerIn, listenerOut := listener.In(), listener.Out()
+	dialerIn, dialerOut := dialer.In(), dialer.Out()
+	for _, p := range []interface{ Open() error }{listenerIn, listenerOut, dialerIn, dialerOut} {
+		p.Open()
+	}
+	listenerIn.SetListener(func(data []byte, deltaMicroseconds int64) {
+		listenerOut.Write(data)
+	})
+	received := make(chan []byte, 1)
+	dialerIn.SetListener(func(data []byte, deltaMicroseconds int64) {
+		received <- data
+	})
+
+	// Long enough for several segments and not a multiple of segment size
+	msg := []byte{0xF0}
+	for i := 0; i < 3*maxSysexSegment+123; i++ {
+		msg = append(msg, byte(i&0x7F))
+	}
+	msg = append(msg, 0xF7)
+	if n := len(segment(msg)); n != 4 {
+		t.Fatalf("SysEx of %d bytes is sent in %d segments, want 4", len(msg), n)
+	}
+
+	// Written in parts as MIDI drivers may do
+	for _, part := range [][]byte{msg[:10], msg[10:2500], msg[2500:]} {
+		if _, err := dialerOut.Write(part); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	select {
+	case echo := <-received:
+		if !bytes.Equal(echo, msg) {
+			t.Errorf("Received %d bytes, sent %d bytes: data differs", len(echo), len(msg))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SysEx was not echoed")
+	}
+}
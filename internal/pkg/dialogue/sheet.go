@@ -0,0 +1,154 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dialogue
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	prologue "dialogue/internal/pkg/dialogue/prologue"
+)
+
+// Sheet formats
+const (
+	SheetMarkdown = "md"
+	SheetHTML     = "html"
+)
+
+// SheetProgram is a program on patch sheet
+type SheetProgram struct {
+	Source string // File or program number the program is from
+	Data   []byte
+	Info   ProgramInfo
+}
+
+type sheetPage struct {
+	Name     string
+	Source   string
+	Info     ProgramInfo
+	Sections []prologue.SheetSection
+}
+
+// WriteSheet writes programs as readable patch sheet (SheetMarkdown or SheetHTML)
+func WriteSheet(w io.Writer, programs []SheetProgram, format string) error {
+	var pages []sheetPage
+	for _, p := range programs {
+		prog, err := prologue.ToProgram(p.Data)
+		if err != nil {
+			return newError(ErrArgument, err, "Cannot decode program '%s'", p.Source)
+		}
+		sections, _ := prologue.Sheet(p.Data)
+		pages = append(pages, sheetPage{prog.Name, p.Source, p.Info, sections})
+	}
+
+	var err error
+	switch format {
+	case SheetMarkdown:
+		err = writeMarkdownSheet(w, pages)
+	case SheetHTML:
+		err = htmlSheet.Execute(w, pages)
+	default:
+		return newError(ErrArgument, nil, "Unknown sheet format '%s' (md, html)", format)
+	}
+	if err != nil {
+		return newError(ErrFile, err, "Cannot write sheet")
+	}
+	return nil
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "*", "\\*", "_", "\\_", "<", "\\<", "\n", " ").Replace(s)
+}
+
+func writeMarkdownSheet(w io.Writer, pages []sheetPage) error {
+	bw := bufio.NewWriter(w)
+
+	for i, page := range pages {
+		if i > 0 {
+			fmt.Fprintf(bw, "\n---\n\n")
+		}
+		fmt.Fprintf(bw, "# %s\n\n", markdownEscape(page.Name))
+		fmt.Fprintf(bw, "*%s*  \n", markdownEscape(page.Source))
+		if page.Info.Programmer != "" {
+			fmt.Fprintf(bw, "**Programmer:** %s  \n", markdownEscape(page.Info.Programmer))
+		}
+		if page.Info.Comment != "" {
+			fmt.Fprintf(bw, "**Comment:** %s  \n", markdownEscape(page.Info.Comment))
+		}
+
+		for _, s := range page.Sections {
+			fmt.Fprintf(bw, "\n## %s\n\n", s.Title)
+			if s.Timbre {
+				fmt.Fprintf(bw, "| Parameter | Main | Sub |\n|---|---|---|\n")
+			} else {
+				fmt.Fprintf(bw, "| Parameter | Value |\n|---|---|\n")
+			}
+			for _, r := range s.Rows {
+				fmt.Fprintf(bw, "| %s |", r.Name)
+				for _, v := range r.Values {
+					fmt.Fprintf(bw, " %s |", markdownEscape(v))
+				}
+				fmt.Fprintf(bw, "\n")
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+var htmlSheet = template.Must(template.New("sheet").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{range $i, $p := .}}{{if $i}}, {{end}}{{$p.Name}}{{end}}</title>
+<style>
+body { font-family: sans-serif; font-size: 11pt; margin: 2em; }
+.program { page-break-after: always; }
+.program:last-child { page-break-after: auto; }
+h1 { margin-bottom: 0; }
+.source { color: #666; margin-top: 0.2em; }
+.sections { display: flex; flex-wrap: wrap; gap: 1em; }
+section { border: 1px solid #999; border-radius: 4px; padding: 0.5em; }
+h2 { font-size: 1em; margin: 0 0 0.4em 0; text-transform: uppercase; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.1em 0.6em 0.1em 0; }
+th { color: #666; font-weight: normal; }
+td.value { font-weight: bold; }
+</style>
+</head>
+<body>
+{{range .}}<div class="program">
+<h1>{{.Name}}</h1>
+<p class="source">{{.Source}}</p>
+{{if .Info.Programmer}}<p><b>Programmer:</b> {{.Info.Programmer}}</p>{{end}}
+{{if .Info.Comment}}<p><b>Comment:</b> {{.Info.Comment}}</p>{{end}}
+<div class="sections">
+{{range .Sections}}<section>
+<h2>{{.Title}}</h2>
+<table>
+{{if .Timbre}}<tr><th></th><th>Main</th><th>Sub</th></tr>{{end}}
+{{range .Rows}}<tr><th>{{.Name}}</th>{{range .Values}}<td class="value">{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</section>
+{{end}}</div>
+</div>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,201 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package sysex
+
+import (
+	"io"
+)
+
+// Korg 7-in-8 packing: each group of 7 data bytes is sent as 8 SysEx bytes.
+// First byte holds the MSBs (bit n = MSB of data byte n), the rest hold the
+// lower 7 bits. Last group may be shorter (n data bytes -> n+1 SysEx bytes).
+
+// EncodedLen returns SysEx length of n data bytes
+func EncodedLen(n int) int {
+	if n%7 == 0 {
+		return n / 7 * 8
+	}
+	return n/7*8 + n%7 + 1
+}
+
+// DecodedLen returns data length of n SysEx bytes
+func DecodedLen(n int) int {
+	if n%8 <= 1 {
+		return n / 8 * 7
+	}
+	return n/8*7 + n%8 - 1
+}
+
+// Encode packs src into dst (at least EncodedLen(len(src)) bytes) and
+// returns number of bytes written
+func Encode(dst []byte, src []byte) int {
+	n := 0
+	for len(src) > 0 {
+		group := src
+		if len(group) > 7 {
+			group = group[:7]
+		}
+		msbs := byte(0)
+		for i, b := range group {
+			msbs |= (b >> 7) << uint(i)
+			dst[n+1+i] = b & 0x7F
+		}
+		dst[n] = msbs
+		n += len(group) + 1
+		src = src[len(group):]
+	}
+	return n
+}
+
+// Decode unpacks src into dst (at least DecodedLen(len(src)) bytes) and
+// returns number of bytes written
+func Decode(dst []byte, src []byte) int {
+	n := 0
+	for len(src) > 1 {
+		group := src
+		if len(group) > 8 {
+			group = group[:8]
+		}
+		msbs := group[0]
+		for i, b := range group[1:] {
+			dst[n+i] = b&0x7F | ((msbs>>uint(i))&0x01)<<7
+		}
+		n += len(group) - 1
+		src = src[len(group):]
+	}
+	return n
+}
+
+// Encoder is an io.Writer that packs written data to 7-bit SysEx data
+type Encoder struct {
+	w     io.Writer
+	group [7]byte // Partial group waiting for more data
+	n     int
+	out   []byte
+}
+
+// NewEncoder returns Encoder writing SysEx data to w. Close must be called
+// to write the last partial group.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Write packs whole groups of p and writes them with one write to the
+// underlying writer. Rest of p is kept until more data is written.
+func (e *Encoder) Write(p []byte) (int, error) {
+	written := 0
+	if e.n > 0 {
+		c := copy(e.group[e.n:], p)
+		e.n += c
+		p = p[c:]
+		written += c
+		if e.n < len(e.group) {
+			return written, nil
+		}
+		if err := e.flush(); err != nil {
+			return written, err
+		}
+	}
+
+	if whole := len(p) / 7 * 7; whole > 0 {
+		if err := e.write(p[:whole]); err != nil {
+			return written, err
+		}
+		p = p[whole:]
+		written += whole
+	}
+
+	e.n = copy(e.group[:], p)
+	return written + e.n, nil
+}
+
+// Close writes the remaining partial group. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.n == 0 {
+		return nil
+	}
+	return e.flush()
+}
+
+func (e *Encoder) flush() error {
+	n := e.n
+	e.n = 0
+	return e.write(e.group[:n])
+}
+
+// write packs data and writes it to the underlying writer
+func (e *Encoder) write(data []byte) error {
+	if size := EncodedLen(len(data)); cap(e.out) < size {
+		e.out = make([]byte, size)
+	}
+	n := Encode(e.out[:cap(e.out)], data)
+	_, err := e.w.Write(e.out[:n])
+	return err
+}
+
+// SysEx bytes the Decoder reads from the underlying reader at a time
+const decoderBufferSize = 64 * 8
+
+// Decoder is an io.Reader that unpacks 7-bit SysEx data read from
+// the underlying reader
+type Decoder struct {
+	r   io.Reader
+	in  [decoderBufferSize]byte // Read, not yet decoded (partial group)
+	inN int
+	out [decoderBufferSize / 8 * 7]byte
+	pos int
+	n   int
+	err error
+}
+
+// NewDecoder returns Decoder reading SysEx data from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Read returns decoded data that is available, reading the underlying
+// reader at most once when there is none
+func (d *Decoder) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for d.pos == d.n {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+	c := copy(p, d.out[d.pos:d.n])
+	d.pos += c
+	return c, nil
+}
+
+// fill reads the underlying reader once and decodes the whole groups read.
+// At EOF the last partial group is decoded too.
+func (d *Decoder) fill() {
+	n, err := d.r.Read(d.in[d.inN:])
+	d.inN += n
+	whole := d.inN / 8 * 8
+	if err == io.EOF {
+		whole = d.inN
+	}
+	d.err = err
+	d.pos = 0
+	d.n = Decode(d.out[:], d.in[:whole])
+	d.inN = copy(d.in[:], d.in[whole:d.inN])
+}
@@ -0,0 +1,249 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+//go:build go1.18
+// +build go1.18
+
+package sysex
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// data returns n bytes using all bit patterns, including set MSBs
+func data(n int) []byte {
+	d := make([]byte, n)
+	for i := range d {
+		d[i] = byte(i*37 + 0x80)
+	}
+	return d
+}
+
+// streamEncode packs src with Encoder, writing step bytes at a time
+func streamEncode(t *testing.T, src []byte, step int) []byte {
+	var out bytes.Buffer
+	enc := NewEncoder(&out)
+	for len(src) > 0 {
+		n := step
+		if n > len(src) {
+			n = len(src)
+		}
+		if w, err := enc.Write(src[:n]); err != nil || w != n {
+			t.Fatalf("Encoder.Write = %d, %v, want %d", w, err, n)
+		}
+		src = src[n:]
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Encoder.Close: %v", err)
+	}
+	return out.Bytes()
+}
+
+// streamDecode unpacks src with Decoder, reading step bytes at a time
+func streamDecode(t *testing.T, src []byte, step int) []byte {
+	var out []byte
+	dec := NewDecoder(bytes.NewReader(src))
+	buf := make([]byte, step)
+	for {
+		n, err := dec.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("Decoder.Read: %v", err)
+		}
+	}
+}
+
+func checkRoundTrip(t *testing.T, src []byte, step int) {
+	encoded := make([]byte, EncodedLen(len(src)))
+	if n := Encode(encoded, src); n != len(encoded) {
+		t.Fatalf("Encode(%d bytes) = %d, want %d", len(src), n, len(encoded))
+	}
+	for i, b := range encoded {
+		if b > 0x7F {
+			t.Fatalf("Encode(%d bytes): byte %d is %#x, not 7-bit", len(src), i, b)
+		}
+	}
+	if n := DecodedLen(len(encoded)); n != len(src) {
+		t.Fatalf("DecodedLen(%d) = %d, want %d", len(encoded), n, len(src))
+	}
+	decoded := make([]byte, len(src))
+	if n := Decode(decoded, encoded); n != len(src) || !bytes.Equal(decoded, src) {
+		t.Fatalf("Decode(Encode(%x)) = %x", src, decoded[:n])
+	}
+
+	streamed := streamEncode(t, src, step)
+	if !bytes.Equal(streamed, encoded) {
+		t.Fatalf("Encoder(%x) in steps of %d = %x, Encode = %x", src, step, streamed, encoded)
+	}
+	if out := streamDecode(t, encoded, step); !bytes.Equal(out, src) {
+		t.Fatalf("Decoder(%x) in steps of %d = %x, want %x", encoded, step, out, src)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Lengths around 7-byte groups, odd steps not aligned to them
+	for n := 0; n <= 3*7+1; n++ {
+		for _, step := range []int{1, 3, 6, 7, 8, 13} {
+			checkRoundTrip(t, data(n), step)
+		}
+	}
+	checkRoundTrip(t, data(336), 5) // Program data
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, n := range []int{0, 1, 6, 7, 8, 13, 14, 15, 336} {
+		f.Add(data(n), uint8(n%7+1))
+	}
+	f.Fuzz(func(t *testing.T, src []byte, step uint8) {
+		if step == 0 {
+			step = 1
+		}
+		checkRoundTrip(t, src, int(step))
+	})
+}
+
+func TestDecoderReturnsAvailable(t *testing.T) {
+	r, w := io.Pipe()
+	defer r.Close()
+
+	encoded := make([]byte, EncodedLen(14))
+	Encode(encoded, data(14))
+	go w.Write(encoded[:8]) // First group only, rest is not written
+
+	buf := make([]byte, 100)
+	done := make(chan int)
+	go func() {
+		n, _ := NewDecoder(r).Read(buf)
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		if n != 7 || !bytes.Equal(buf[:n], data(14)[:7]) {
+			t.Errorf("Read = %x, want first group %x", buf[:n], data(14)[:7])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read blocked with a decoded group available")
+	}
+}
+
+// Baseline: the conversion before Encode/Decode, appending per group
+
+func appendEncode(data []byte) []byte {
+	var out []byte
+	for len(data) > 0 {
+		n := len(data)
+		if n > 7 {
+			n = 7
+		}
+		group := make([]byte, n+1)
+		for i := 0; i < n; i++ {
+			group[0] += (data[i] & 0x80) >> uint(7-i)
+			group[i+1] = data[i] & 0x7F
+		}
+		out = append(out, group...)
+		data = data[n:]
+	}
+	return out
+}
+
+func appendDecode(sysexData []byte) []byte {
+	var out []byte
+	for len(sysexData) > 1 {
+		n := len(sysexData)
+		if n > 8 {
+			n = 8
+		}
+		group := make([]byte, n-1)
+		for i := range group {
+			group[i] = sysexData[i+1] | ((sysexData[0]>>uint(i))&0x01)<<7
+		}
+		out = append(out, group...)
+		sysexData = sysexData[n:]
+	}
+	return out
+}
+
+const benchmarkSize = 64 * 1024
+
+func encodedData() []byte {
+	src := make([]byte, EncodedLen(benchmarkSize))
+	Encode(src, data(benchmarkSize))
+	return src
+}
+
+func BenchmarkAppendEncode(b *testing.B) {
+	src := data(benchmarkSize)
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		appendEncode(src)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	src := data(benchmarkSize)
+	dst := make([]byte, EncodedLen(len(src)))
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		Encode(dst, src)
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	src := data(benchmarkSize)
+	var out bytes.Buffer
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		enc := NewEncoder(&out)
+		for start := 0; start < len(src); start += 1024 { // As in transfers
+			enc.Write(src[start : start+1024])
+		}
+		enc.Close()
+	}
+}
+
+func BenchmarkAppendDecode(b *testing.B) {
+	src := encodedData()
+	b.SetBytes(benchmarkSize)
+	for i := 0; i < b.N; i++ {
+		appendDecode(src)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	src := encodedData()
+	dst := make([]byte, DecodedLen(len(src)))
+	b.SetBytes(int64(len(dst)))
+	for i := 0; i < b.N; i++ {
+		Decode(dst, src)
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	src := encodedData()
+	dst := make([]byte, DecodedLen(len(src)))
+	b.SetBytes(int64(len(dst)))
+	for i := 0; i < b.N; i++ {
+		io.ReadFull(NewDecoder(bytes.NewReader(src)), dst)
+	}
+}
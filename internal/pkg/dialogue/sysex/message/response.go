@@ -35,4 +35,26 @@ var ResponseInfo = map[byte]ResponseEntry {
 	UserSlotStatusRequest : {UserSlotStatus, 3},
 	UserModuleInfoRequest : {UserModuleInfo, 2},		
 	ClearUserSlot : {DataLoadCompleted, -1},
+	GlobalDataDump : {DataLoadCompleted, -1},
+	TuningScaleDataDumpRequest : {TuningScaleDataDump, 1},
+	TuningScaleDataDump : {DataLoadCompleted, -1},
+	TuningOctaveDataDumpRequest : {TuningOctaveDataDump, 1},
+	TuningOctaveDataDump : {DataLoadCompleted, -1},
+	LivesetDataDumpRequest : {LivesetDataDump, 0},
+	LivesetDataDump : {DataLoadCompleted, -1},
+}
+
+// ErrorText describes status types that device sends when request failed
+var ErrorText = map[byte]string{
+	DataLoadError:     "Data load error",
+	DataFormatError:   "Data format error",
+	UserDataSizeError: "User data size error",
+	UserDataCRCError:  "User data CRC error",
+	UserTargetError:   "User target error",
+	UserAPIError:      "User API error",
+	UserLoadSizeError: "User load size error",
+	UserModuleError:   "User module error",
+	UserSlotError:     "User slot error",
+	UserFormatError:   "User format error",
+	UserInternalError: "User internal error",
 }
@@ -20,87 +20,110 @@ package dialogue
 import (
 	//"encoding/hex"
 
-	"fmt"
+	"context"
 
 	sysex "dialogue/internal/pkg/dialogue/sysex"
 	sysexMessageType "dialogue/internal/pkg/dialogue/sysex/message"
 )
 
-func SetUserSlotData(moduleTypeSlot string, filename string) <-chan error {
+// SlotStatus is the status of one user slot. Header is valid if slot is not empty.
+type SlotStatus struct {
+	ModuleID byte
+	SlotID   byte
+	Empty    bool
+	Header   sysex.Header
+}
 
+func parseModuleSlotOnly(moduleTypeSlot string) (byte, byte, error) {
 	moduleID, slotID, isOnlyModule, err := ParseModuleSlot(moduleTypeSlot)
-
-	errChan := make(chan error, 1)
-
 	if err != nil || isOnlyModule {
-		err := fmt.Errorf("Wrong module slot definition. Please use 'module/slot' format!")
-		errChan <- err
-		return errChan
+		return 0, 0, newError(ErrArgument, nil, "Wrong module slot definition '%s'. Please use 'module/slot' format!", moduleTypeSlot)
 	}
+	return moduleID, slotID, nil
+}
 
-	m := getDataFromZipFile(".json", filename)
-	man := sysex.ToModuleManifest(m)
-	b := getDataFromZipFile(".bin", filename)
-	_, modData := man.CreateModuleData(b)
+// WriteUserSlot sends module data (header & payload) to module slot
+func WriteUserSlot(ctx context.Context, moduleTypeSlot string, modData []byte) error {
+	moduleID, slotID, err := parseModuleSlotOnly(moduleTypeSlot)
+	if err != nil {
+		return err
+	}
 
 	resp := <-getData(
+		ctx,
 		sysexMessageType.UserSlotData,
 		sysex.UserSlotHeader(moduleID, slotID),
 		modData,
 	)
-
-	errChan <- resp.err
-	return errChan
+	return resp.err
 }
 
-func GetUserSlotData(moduleTypeSlot string, filename string) <-chan error {
-
-	moduleID, slotID, isOnlyModule, err := ParseModuleSlot(moduleTypeSlot)
-
-	errChan := make(chan error, 1)
-
-	if err != nil || isOnlyModule {
-		err := fmt.Errorf("Wrong module slot definition. Please use 'module/slot' format!")
-		errChan <- err
-		return errChan
+// ReadUserSlot returns module stored in module slot
+func ReadUserSlot(ctx context.Context, moduleTypeSlot string) (sysex.Module, error) {
+	moduleID, slotID, err := parseModuleSlotOnly(moduleTypeSlot)
+	if err != nil {
+		return sysex.Module{}, err
 	}
 
 	resp := <-getData(
+		ctx,
 		sysexMessageType.UserSlotDataRequest,
 		sysex.UserSlotHeader(moduleID, slotID),
 		nil,
 	)
 
-	if resp.data != nil {
-		mod := sysex.ToModule(resp.data)
-		files := map[string][]byte{
-			mod.Header.Name + "/" + "manifest.json": []byte(mod.Header.CreateManifestJSON("prologue")),
-			mod.Header.Name + "/" + "payload.bin":   mod.Payload,
-		}
+	if resp.err != nil {
+		return sysex.Module{}, resp.err
+	}
+	if len(resp.data) < 1032 {
+		return sysex.Module{}, newError(ErrDevice, nil, "Slot '%s' is empty!", moduleTypeSlot)
+	}
+	return sysex.ToModule(resp.data), nil
+}
 
-		err := createZipFile(filename, files)
+// DecodeModule returns module of module data (header & payload)
+func DecodeModule(data []byte) (sysex.Module, error) {
+	if len(data) < 1032 || len(data) < 1032+int(sysex.ToHeader(data).PayloadSize) {
+		return sysex.Module{}, newError(ErrArgument, nil, "Module data is too short (%d bytes)", len(data))
+	}
+	return sysex.ToModule(data), nil
+}
 
-		if err != nil {
-			err := fmt.Errorf("ERROR:Cannot create file!")
-			errChan <- err
-			return errChan
-		}
+// LoadUnitFile returns module data (header & payload) from user unit file (*.XXXunit)
+func LoadUnitFile(filename string) ([]byte, error) {
+	m, err := getDataFromZipFile(".json", filename)
+	if err != nil {
+		return nil, err
+	}
+	b, err := getDataFromZipFile(".bin", filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 || len(b) == 0 {
+		return nil, newError(ErrFile, nil, "No manifest or payload in '%s'!", filename)
+	}
+	man := sysex.ToModuleManifest(m)
+	_, modData := man.CreateModuleData(b)
+	return modData, nil
+}
 
+// SaveUnitFile writes module to user unit file (*.XXXunit)
+func SaveUnitFile(filename string, mod sysex.Module) error {
+	files := map[string][]byte{
+		mod.Header.Name + "/" + "manifest.json": []byte(mod.Header.CreateManifestJSON(dlg.getDeviceSpecificInfo().deviceName)),
+		mod.Header.Name + "/" + "payload.bin":   mod.Payload,
 	}
-	errChan <- resp.err
-	return errChan
+
+	return createZipFile(filename, files)
 }
 
-func DeleteUserData(moduleTypeSlot string) <-chan error {
+// DeleteUserData clears module slot or all slots of module
+func DeleteUserData(ctx context.Context, moduleTypeSlot string) error {
 
 	moduleID, slotID, isOnlyModule, err := ParseModuleSlot(moduleTypeSlot)
 
-	errChan := make(chan error, 1)
-
 	if err != nil {
-		err := fmt.Errorf(err.Error())
-		errChan <- err
-		return errChan
+		return err
 	}
 
 	var msgType byte
@@ -114,66 +137,55 @@ func DeleteUserData(moduleTypeSlot string) <-chan error {
 		hdr = sysex.UserSlotHeader(moduleID, slotID)
 	}
 
-	resp := <-getData(msgType, hdr, nil)
-
-	errChan <- resp.err
-	return errChan
+	resp := <-getData(ctx, msgType, hdr, nil)
+	return resp.err
 }
 
-func GetUserDataInfo(moduleTypeSlot string) <-chan error {
-	moduleID, slotID, isOnlyModule, err := ParseModuleSlot(moduleTypeSlot)
+// ReadUserModuleInfo returns slot size limits and slot count of module
+func ReadUserModuleInfo(ctx context.Context, module string) (sysex.ModuleInfo, error) {
+	moduleID := sysex.ModuleID(module)
+	if moduleID == 0 {
+		return sysex.ModuleInfo{}, newError(ErrArgument, nil, "Unknown module '%s'!", module)
+	}
 
-	errChan := make(chan error, 1)
+	resp := <-getData(ctx, sysexMessageType.UserModuleInfoRequest, []byte{moduleID}, nil)
+
+	if resp.err != nil {
+		return sysex.ModuleInfo{}, resp.err
+	}
+	if len(resp.data) != 9 {
+		return sysex.ModuleInfo{}, newError(ErrCommunication, nil, "Received wrong data!")
+	}
+	return sysex.ToModuleInfo(resp.data), nil
+}
 
+// ReadUserSlotStatus returns status of module slot
+func ReadUserSlotStatus(ctx context.Context, moduleTypeSlot string) (SlotStatus, error) {
+	moduleID, slotID, err := parseModuleSlotOnly(moduleTypeSlot)
 	if err != nil {
-		err := fmt.Errorf(err.Error())
-		errChan <- err
-		return errChan
+		return SlotStatus{}, err
 	}
 
-	var msgType byte
-	var hdr []byte
+	resp := <-getData(ctx, sysexMessageType.UserSlotStatusRequest, sysex.UserSlotHeader(moduleID, slotID), nil)
 
-	if isOnlyModule {
-		msgType = sysexMessageType.UserModuleInfoRequest
-		hdr = []byte{moduleID}
-	} else {
-		msgType = sysexMessageType.UserSlotStatusRequest
-		hdr = sysex.UserSlotHeader(moduleID, slotID)
+	status := SlotStatus{ModuleID: moduleID, SlotID: slotID}
+
+	if resp.err != nil {
+		return status, resp.err
 	}
 
-	resp := <-getData(msgType, hdr, nil)
+	if len(resp.data) == 0 {
+		status.Empty = true
+		return status, nil
+	}
 
-	if isOnlyModule {
-		if len(resp.data) == 9 {
-			mi := sysex.ToModuleInfo(resp.data)
-			fmt.Printf("\nSlot:'%s' - Max slot size:%d, Max program size:%d, Slot count:%d\n\n",
-				moduleTypeSlot,
-				mi.MaxSlotSize,
-				mi.MaxProgramSize,
-				mi.SlotCount,
-			)
-		}
-	} else {
-		if resp.err == nil && len(resp.data) == 0 {
-			fmt.Printf("\nSlot '%s' is empty!\n\n", moduleTypeSlot)
-		} else {
-			buf := make([]byte, 8)
-			buf = append(buf, resp.data...)
-			fill := make([]byte, 1032-len(buf))
-			buf = append(buf, fill...)
-			hdr := sysex.ToHeader(buf)
-			fmt.Printf("\nSlot:'%s' - Name:%s, Ver:%s, API:%s, DevID:%d, ProgID:%d\n\n",
-				moduleTypeSlot,
-				hdr.Name,
-				hdr.Version.VersionString(),
-				hdr.APIVersion.VersionString(),
-				hdr.DeveloperID,
-				hdr.ProgramID,
-			)
-		}
-	}
-
-	errChan <- resp.err
-	return errChan
+	// Status has the header without size & CRC fields
+	buf := make([]byte, 8)
+	buf = append(buf, resp.data...)
+	if len(buf) < 1032 {
+		fill := make([]byte, 1032-len(buf))
+		buf = append(buf, fill...)
+	}
+	status.Header = sysex.ToHeader(buf)
+	return status, nil
 }
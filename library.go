@@ -0,0 +1,73 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parsePatchOption parses program number or range of -p option. Edit
+// buffer is -1.
+func parsePatchOption(s string) (int, int, error) {
+	if strings.Contains(strings.TrimPrefix(s, "-"), "-") {
+		return parseProgramRange(s)
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, 0, argumentError("Invalid program number '%s'", s)
+	}
+	return n, n, nil
+}
+
+// readLibrary saves programs first-last from device to library file
+func readLibrary(ctx context.Context, filename string, first int, last int, info logue.ProgramInfo) error {
+	var programs [][]byte
+	var infos []logue.ProgramInfo
+	err := readPrograms(ctx, first, last, func(n int, data []byte) error {
+		programs = append(programs, data)
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return logue.SaveProgramLibrary(filename, programs, infos)
+}
+
+// writeLibrary sends programs of library file to device starting from
+// program first. If last is given (not first), at most last-first+1
+// programs are sent.
+func writeLibrary(ctx context.Context, programs [][]byte, first int, last int) error {
+	if first < 1 {
+		return argumentError("Starting program number (-p) is needed for library")
+	}
+	if last > first && len(programs) > last-first+1 {
+		programs = programs[:last-first+1]
+	}
+	if first+len(programs)-1 > 500 {
+		return argumentError("%d programs do not fit from program %d (1-500)", len(programs), first)
+	}
+
+	return eachWithProgress(len(programs),
+		func(i int) string { return fmt.Sprintf("Writing program %d/%d", first+i, first+len(programs)-1) },
+		func(i int) error { return logue.SetProgram(ctx, first+i, programs[i]) })
+}
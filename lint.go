@@ -0,0 +1,195 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func lintNeedsDevice(args []string) bool {
+	for _, arg := range args {
+		if arg == "-slots" || arg == "--slots" {
+			return true
+		}
+	}
+	return anyProgramSlot(args)
+}
+
+type linter struct {
+	ctx        context.Context
+	fix        bool
+	checkSlots bool
+	emptySlots map[string]bool // Status of checked slots, e.g. "osc/2"
+	problems   int
+	fixed      int
+}
+
+func runLint(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "Clamp values to their ranges, drop references to empty user slots and rewrite the programs.")
+	checkSlots := fs.Bool("slots", false, "Check user oscillator & effect slots on device.")
+
+	sources, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return argumentError("Missing programs to check")
+	}
+
+	l := &linter{
+		ctx:        ctx,
+		fix:        *fix,
+		checkSlots: *checkSlots,
+		emptySlots: map[string]bool{},
+	}
+
+	for _, source := range sources {
+		if isProgramSlot(source) {
+			err = l.lintSlot(source)
+		} else {
+			err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return fileError(err, "Cannot read '%s'", path)
+				}
+				if info.IsDir() || !isProgramFile(path) {
+					return nil
+				}
+				return l.lintFile(path)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.fixed > 0 {
+		fmt.Fprintf(os.Stderr, "%d programs fixed\n", l.fixed)
+	}
+	if l.problems > 0 && !l.fix {
+		return argumentError("%d problems found", l.problems)
+	}
+	return nil
+}
+
+func (l *linter) lintSlot(arg string) error {
+	data, err := loadProgram(l.ctx, arg)
+	if err != nil {
+		return err
+	}
+	data, changed, err := l.lint(arg, data)
+	if err != nil || !changed {
+		return err
+	}
+	return saveProgram(l.ctx, arg, data)
+}
+
+func (l *linter) lintFile(filename string) error {
+	programs, err := logue.LoadPrograms(filename)
+	if err != nil {
+		return err
+	}
+
+	fileChanged := false
+	for i, data := range programs {
+		source := filename
+		if len(programs) > 1 {
+			source = fmt.Sprintf("%s#%d", filename, i+1)
+		}
+		data, changed, err := l.lint(source, data)
+		if err != nil {
+			return err
+		}
+		programs[i] = data
+		fileChanged = fileChanged || changed
+	}
+
+	if !fileChanged {
+		return nil
+	}
+	return logue.UpdateProgramFile(filename, programs)
+}
+
+// lint prints problems of program and returns fixed program if fixing is on
+func (l *linter) lint(source string, data []byte) ([]byte, bool, error) {
+	issues, err := logue.LintProgram(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var empty []logue.SlotRef
+	if l.checkSlots {
+		if empty, err = l.emptySlotRefs(data); err != nil {
+			return nil, false, err
+		}
+	}
+	for _, ref := range empty {
+		issues = append(issues, logue.Issue{Name: ref.Name, Value: ref.String(), Message: "user slot is empty"})
+	}
+
+	for _, issue := range issues {
+		fmt.Printf("%s: %s = %s: %s\n", source, issue.Name, issue.Value, issue.Message)
+	}
+	l.problems += len(issues)
+
+	if !l.fix || len(issues) == 0 {
+		return data, false, nil
+	}
+
+	data, err = logue.SanitizeProgram(data)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, ref := range empty {
+		if data, err = logue.DropSlotRef(data, ref); err != nil {
+			return nil, false, err
+		}
+	}
+	l.fixed++
+	return data, true, nil
+}
+
+// emptySlotRefs returns references of program to empty user slots on device
+func (l *linter) emptySlotRefs(data []byte) ([]logue.SlotRef, error) {
+	refs, err := logue.ProgramSlotRefs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var empty []logue.SlotRef
+	for _, ref := range refs {
+		isEmpty, ok := l.emptySlots[ref.String()]
+		if !ok {
+			status, err := logue.GetUserSlotStatus(l.ctx, ref.String())
+			if err != nil {
+				return nil, err
+			}
+			isEmpty = status.Empty
+			l.emptySlots[ref.String()] = isEmpty
+		}
+		if isEmpty {
+			empty = append(empty, ref)
+		}
+	}
+	return empty, nil
+}
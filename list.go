@@ -0,0 +1,242 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"dialogue/pkg/logue"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// programSummary holds the listed fields of a program
+type programSummary struct {
+	Number     int      `json:"number"`
+	Name       string   `json:"name"`
+	TimbreType string   `json:"timbre_type"`
+	UserOsc    []string `json:"user_osc"` // e.g. "main:osc/2"
+
+	UserSlots []logue.SlotRef `json:"user_slots"`
+}
+
+// listCacheVersion changes with programSummary, caches of other versions
+// are not used
+const listCacheVersion = 2
+
+// listCache maps program numbers to dump hashes and hashes to summaries,
+// so unchanged programs are not decoded again and the last listing can be
+// shown without the device
+type listCache struct {
+	Version  int                       `json:"version"`
+	Slots    map[string]string         `json:"slots"`
+	Programs map[string]programSummary `json:"programs"`
+}
+
+func defaultListCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dialogue", "list.json")
+}
+
+func newListCache() *listCache {
+	return &listCache{Version: listCacheVersion, Slots: map[string]string{}, Programs: map[string]programSummary{}}
+}
+
+func loadListCache(filename string) *listCache {
+	if filename == "" {
+		return newListCache()
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return newListCache()
+	}
+	c := &listCache{}
+	if json.Unmarshal(data, c) != nil || c.Version != listCacheVersion || c.Slots == nil || c.Programs == nil {
+		return newListCache()
+	}
+	return c
+}
+
+func (c *listCache) save(filename string) error {
+	if filename == "" {
+		return nil
+	}
+	data, _ := json.MarshalIndent(c, "", " ")
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fileError(err, "Cannot create cache directory")
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return fileError(err, "Cannot write cache '%s'", filename)
+	}
+	return nil
+}
+
+// summary returns cached summary of program dump, decoding it if not cached
+func (c *listCache) summary(number int, data []byte) (programSummary, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	c.Slots[strconv.Itoa(number)] = hash
+
+	if s, ok := c.Programs[hash]; ok {
+		s.Number = number
+		return s, nil
+	}
+
+	prog, err := logue.DecodeProgram(data)
+	if err != nil {
+		return programSummary{}, err
+	}
+	refs, err := logue.ProgramSlotRefs(data)
+	if err != nil {
+		return programSummary{}, err
+	}
+	s := programSummary{
+		Number:     number,
+		Name:       prog.Name,
+		TimbreType: prog.TimbreType.String(),
+		UserOsc:    []string{},
+		UserSlots:  append([]logue.SlotRef{}, refs...),
+	}
+	for _, t := range []struct {
+		name   string
+		timbre logue.Timbre
+	}{{"main", prog.Main}, {"sub", prog.Sub}} {
+		if t.timbre.Multi.Type == logue.MultiUser {
+			s.UserOsc = append(s.UserOsc, fmt.Sprintf("%s:osc/%d", t.name, t.timbre.Multi.User))
+		}
+	}
+	c.Programs[hash] = s
+	return s, nil
+}
+
+// parseProgramRange parses "N" or "N-M" (1-500)
+func parseProgramRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	first, err := strconv.Atoi(parts[0])
+	last := first
+	if err == nil && len(parts) == 2 {
+		last, err = strconv.Atoi(parts[1])
+	}
+	if err != nil || first < 1 || last > 500 || first > last {
+		return 0, 0, argumentError("Invalid program range '%s' (1-500)", s)
+	}
+	return first, last, nil
+}
+
+// readPrograms reads programs first-last from device, passing each to f
+func readPrograms(ctx context.Context, first int, last int, f func(n int, data []byte) error) error {
+	return eachWithProgress(last-first+1,
+		func(i int) string { return fmt.Sprintf("Reading program %d/%d", first+i, last) },
+		func(i int) error {
+			data, err := logue.GetProgram(ctx, first+i)
+			if err != nil {
+				return err
+			}
+			return f(first+i, data)
+		})
+}
+
+// readSummaries reads programs first-last from device and updates cache
+func readSummaries(ctx context.Context, cache *listCache, cacheFile string, first int, last int) ([]programSummary, error) {
+	var list []programSummary
+	err := readPrograms(ctx, first, last, func(n int, data []byte) error {
+		s, err := cache.summary(n, data)
+		list = append(list, s)
+		return err
+	})
+	if err != nil {
+		cache.save(cacheFile)
+		return nil, err
+	}
+	return list, cache.save(cacheFile)
+}
+
+func listNeedsDevice(args []string) bool {
+	for _, arg := range args {
+		if arg == "-cached" || arg == "--cached" {
+			return false
+		}
+	}
+	return true
+}
+
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	asCSV := fs.Bool("csv", false, "Output as CSV.")
+	asJSON := fs.Bool("json", false, "Output as JSON.")
+	cached := fs.Bool("cached", false, "List from cache without reading the device.")
+	cacheFile := fs.String("cache", defaultListCacheFile(), "Cache file.")
+
+	ranges, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ranges) > 1 {
+		return argumentError("Expected one program range")
+	}
+	first, last := 1, 500
+	if len(ranges) == 1 {
+		if first, last, err = parseProgramRange(ranges[0]); err != nil {
+			return err
+		}
+	}
+
+	cache := loadListCache(*cacheFile)
+	var list []programSummary
+
+	if *cached {
+		list = cachedSummaries(cache, first, last)
+	} else if list, err = readSummaries(ctx, cache, *cacheFile, first, last); err != nil {
+		return err
+	}
+
+	switch {
+	case *asJSON:
+		if list == nil {
+			list = []programSummary{}
+		}
+		out, _ := json.MarshalIndent(list, "", "  ")
+		fmt.Println(string(out))
+
+	case *asCSV:
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"number", "name", "timbre_type", "user_osc"})
+		for _, s := range list {
+			w.Write([]string{strconv.Itoa(s.Number), s.Name, s.TimbreType, strings.Join(s.UserOsc, " ")})
+		}
+		w.Flush()
+
+	default:
+		fmt.Printf("%4s  %-12s  %-6s  %s\n", "No", "Name", "Timbre", "User osc")
+		for _, s := range list {
+			fmt.Printf("%4d  %-12s  %-6s  %s\n", s.Number, s.Name, s.TimbreType, strings.Join(s.UserOsc, " "))
+		}
+	}
+	return nil
+}
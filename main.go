@@ -24,10 +24,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	dlg "dialogue/internal/pkg/dialogue"
+	"dialogue/pkg/logue"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -38,114 +43,317 @@ func main() {
 		explicitMidiInIdx  = flag.Int("in", -1, "Set Midi input (index) explicitely. -1 = Auto detect.")
 		explicitMidiOutIdx = flag.Int("out", -1, "Set Midi output (index) explicitely. -1 = Auto detect.")
 		enablePortListing  = flag.Bool("l", false, "Show available MIDI ports.")
-		patchNumber        = flag.Int("p", -1, "Program number. -1 = Edit buffer.")
-		mode               = flag.String("m", "pw", "Operation mode: pw, pr, uw, ur, ui, ud.")
+		patchOption        = flag.String("p", "-1", "Program number or range (first-last) for library. -1 = Edit buffer.")
+		mode               = flag.String("m", "pw", "Operation mode: pw, pr, uw, ur, ui, ud, mon.")
 		moduleTypeSlot     = flag.String("s", "osc/0", "Module type & slot.")
 		debug              = flag.Bool("d", false, "Enable extra debug prints.")
+		networkAddress     = flag.String("net", "", "RTP-MIDI session (host:port) to use instead of local MIDI ports.")
+		chunkSize          = flag.Int("chunk", 0, "Send SysEx in chunks of given size (bytes). 0 = Whole message at once.")
+		chunkDelay         = flag.Int("delay", 0, "Delay between SysEx chunks (ms).")
+		bytesPerSecond     = flag.Int("bps", 0, "Target SysEx transmission rate (bytes/s), used if -delay is not set.")
+		captureFile        = flag.String("capture", "", "Record sent & received SysEx to file (for bug reports & replay).")
+		replayFile         = flag.String("replay", "", "Replay capture file as a fake device instead of MIDI ports.")
+		programmer         = flag.String("programmer", "", "Programmer saved to program file (pr).")
+		comment            = flag.String("comment", "", "Comment saved to program file (pr).")
+		pick               = flag.String("pick", "", "Program of library file to send (pw): number in library or name.")
+		depsRange          = flag.String("deps-range", "1-500", "Programs checked for use of the slot before uw/ud (first-last).")
+		depsCached         = flag.Bool("deps-cached", false, "Check programs listed last time instead of reading the device (uw/ud).")
+		noDeps             = flag.Bool("no-deps", false, "Do not check programs using the slot before uw/ud.")
+		yes                = flag.Bool("y", false, "Do not ask for confirmation when programs use the slot (uw/ud).")
 	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: dialogue [options] [file | command]\n\nOptions:\n")
+		flag.PrintDefaults()
+		printCommandUsage()
+	}
 	flag.Parse()
 
-	if len(flag.Args()) > 1 {
-		fmt.Printf("Only one file at a time!")
-		os.Exit(-1)
+	cmd, isCommand := commands[flag.Arg(0)]
+
+	if len(flag.Args()) > 1 && !isCommand {
+		checkError(argumentError("Only one file at a time!"))
 	}
 
 	filename := flag.Arg(0)
 
+	patchNumber, lastPatchNumber, err := parsePatchOption(*patchOption)
+	checkError(err)
+
 	if *debug {
-		dlg.EnableDebugging()
+		logue.EnableDebugging()
 	}
 
-	err := dlg.Open()
-	checkError(err)
+	if isTerminal(os.Stdout) {
+		logue.SetProgress(newProgressBar())
+	}
+
+	if *chunkSize > 0 || *bytesPerSecond > 0 {
+		logue.SetPacing(logue.Pacing{
+			ChunkSize:      *chunkSize,
+			Delay:          time.Duration(*chunkDelay) * time.Millisecond,
+			BytesPerSecond: *bytesPerSecond,
+		})
+	}
 
-	defer dlg.Close()
+	defer logue.Close()
 
-	if *enablePortListing {
-		dlg.ListMidiPorts()
+	if *captureFile != "" {
+		f, err := os.Create(*captureFile)
+		if err != nil {
+			checkError(&logue.Error{Class: logue.ErrFile, Op: fmt.Sprintf("Cannot create capture file '%s'", *captureFile), Err: err})
+		}
+		defer f.Close()
+		err = logue.StartCapture(f)
+		checkError(err)
 	}
 
-	dlg.SetDevice(dlg.Prologue{DeviceID: byte(*deviceID)})
+	// Ctrl-C cancels the operation in progress, second one exits immediately
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	var in, out int
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Printf("\nInterrupted! Stopping...\n")
+		cancel()
+		<-sigs
+		restoreTerminal(os.Stdin)
+		os.Exit(exitCancelled)
+	}()
 
-	inFound, outFound := dlg.FindMidiIO()
+	logue.SetDevice(logue.Prologue{DeviceID: byte(*deviceID)})
 
-	if *explicitMidiInIdx >= 0 {
-		in = *explicitMidiInIdx
-	} else {
-		in = inFound
+	// Commands working on files only
+	if isCommand && (cmd.device == nil || !cmd.device(flag.Args()[1:])) {
+		checkError(cmd.run(ctx, flag.Args()[1:]))
+		return
 	}
-	if *explicitMidiOutIdx >= 0 {
-		out = *explicitMidiOutIdx
+
+	if *replayFile != "" {
+		err = logue.SetReplayMidi(*replayFile)
+		checkError(err)
+
+		if *debug {
+			fmt.Fprintf(os.Stderr, "DEBUG: Replaying capture <%s> - channel <%d>\n", *replayFile, *deviceID)
+		}
+	} else if *networkAddress != "" {
+		err = logue.SetNetworkMidi(*networkAddress)
+		checkError(err)
+
+		if *debug {
+			fmt.Fprintf(os.Stderr, "DEBUG: Using RTP-MIDI session <%s> - channel <%d>\n", *networkAddress, *deviceID)
+		}
 	} else {
-		out = outFound
-	}
+		err = logue.Open()
+		checkError(err)
 
-	if in < 0 || out < 0 {
-		dlg.ListMidiPorts()
-		fmt.Printf("\nNo supported devices found! Please try to set MIDI in & out ports explicitely.")
-		os.Exit(-1)
-	}
+		if *enablePortListing {
+			listMidiPorts()
+		}
 
-	if *debug {
-		fmt.Printf("\nDEBUG: Using MIDI (in:%d / out:%d) - channel <%d>\n", in, out, *deviceID)
+		var in, out int
+
+		inFound, outFound := logue.FindMidiIO()
+
+		if *explicitMidiInIdx >= 0 {
+			in = *explicitMidiInIdx
+		} else {
+			in = inFound
+		}
+		if *explicitMidiOutIdx >= 0 {
+			out = *explicitMidiOutIdx
+		} else {
+			out = outFound
+		}
+
+		if in < 0 || out < 0 {
+			listMidiPorts()
+			checkError(&logue.Error{Class: logue.ErrPort, Op: "No supported devices found! Please try to set MIDI in & out ports explicitely."})
+		}
+
+		if *debug {
+			fmt.Fprintf(os.Stderr, "DEBUG: Using MIDI (in:%d / out:%d) - channel <%d>\n", in, out, *deviceID)
+		}
+
+		err = logue.SetMidi(in, out)
+		checkError(err)
 	}
 
-	err = dlg.SetMidi(in, out)
-	checkError(err)
+	if isCommand {
+		checkError(cmd.run(ctx, flag.Args()[1:]))
+		return
+	}
 
 	// Exit if no files to process...
-	if filename == "" && !(*mode == "ud" || *mode == "ui") {
+	if filename == "" && !(*mode == "ud" || *mode == "ui" || *mode == "mon") {
 		// Select program if opted even no files to process
-		if *patchNumber > 0 {
-			fmt.Printf("Selecting program <%d>\n", *patchNumber)
-			dlg.SelectProgram(*patchNumber)
+		if patchNumber > 0 {
+			fmt.Printf("Selecting program <%d>\n", patchNumber)
+			checkError(logue.SelectProgram(ctx, patchNumber))
 		}
-		os.Exit(0)
+		return
 	}
 
 	// Use patch number only if in valid range (1-500). Defaults to edit buffer...
 	switch *mode {
 
 	case "pr":
-		err = <-dlg.GetProgram(*patchNumber, filename)
-		checkError(err)
-		if err == nil {
-			fmt.Printf("\nProgram file '%s' saved to file!\n", filename)
+		info := logue.ProgramInfo{Programmer: *programmer, Comment: *comment}
+		if lastPatchNumber > patchNumber {
+			err = readLibrary(ctx, filename, patchNumber, lastPatchNumber, info)
+			checkError(err)
+			fmt.Printf("\nPrograms %d-%d saved to library '%s'!\n", patchNumber, lastPatchNumber, filename)
+			return
 		}
+		data, err := logue.GetProgram(ctx, patchNumber)
+		checkError(err)
+		err = logue.SaveProgramFileWithInfo(filename, data, info)
+		checkError(err)
+		fmt.Printf("\nProgram file '%s' saved to file!\n", filename)
 
 	case "pw":
-		err = <-dlg.SetProgram(*patchNumber, filename)
+		programs, err := logue.LoadPrograms(filename)
 		checkError(err)
-		if err == nil {
-			fmt.Printf("\nProgram file '%s' sent to device!\n", filename)
+		if *pick != "" {
+			data, err := logue.PickProgram(filename, *pick)
+			checkError(err)
+			programs = [][]byte{data}
+		}
+		if len(programs) > 1 {
+			err = writeLibrary(ctx, programs, patchNumber, lastPatchNumber)
+			checkError(err)
+			fmt.Printf("\nLibrary '%s' sent to device!\n", filename)
+			return
 		}
+		if len(programs) == 0 {
+			checkError(&logue.Error{Class: logue.ErrFile, Op: fmt.Sprintf("No program data in '%s'!", filename)})
+		}
+		err = logue.SetProgram(ctx, patchNumber, programs[0])
+		checkError(err)
+		fmt.Printf("\nProgram file '%s' sent to device!\n", filename)
 
 	case "ur":
-		err = <-dlg.GetUserSlotData(*moduleTypeSlot, filename)
+		mod, err := logue.GetUserSlot(ctx, *moduleTypeSlot)
+		checkError(err)
+		err = logue.SaveUnitFile(filename, mod)
 		checkError(err)
 		fmt.Printf("\nUser data read - %s!\n", *moduleTypeSlot)
 
 	case "uw":
-		err = <-dlg.SetUserSlotData(*moduleTypeSlot, filename)
+		modData, err := logue.LoadUnitFile(filename)
+		checkError(err)
+		if !*noDeps {
+			checkError(warnDependents(ctx, *moduleTypeSlot, depsCheck{*depsRange, *depsCached, *yes}))
+		}
+		err = logue.SetUserSlot(ctx, *moduleTypeSlot, modData)
 		checkError(err)
 		fmt.Printf("\nUser data sent to device!\n")
 
 	case "ud":
-		err = <-dlg.DeleteUserData(*moduleTypeSlot)
+		if !*noDeps {
+			checkError(warnDependents(ctx, *moduleTypeSlot, depsCheck{*depsRange, *depsCached, *yes}))
+		}
+		err = logue.DeleteUserData(ctx, *moduleTypeSlot)
 		checkError(err)
 		fmt.Printf("\nUser data '%s' deleted!\n", *moduleTypeSlot)
 
+	case "mon":
+		events, unsubscribe := logue.SubscribeChannelEvents(64)
+		defer unsubscribe()
+		fmt.Printf("Monitoring device messages (Ctrl-C to stop)...\n")
+		for {
+			select {
+			case ev := <-events:
+				fmt.Printf("%s  %s\n", ev.Time.Format("15:04:05.000"), ev.Message)
+			case <-ctx.Done():
+				return
+			}
+		}
+
 	case "ui":
-		err = <-dlg.GetUserDataInfo(*moduleTypeSlot)
+		_, _, isModuleOnly, err := logue.ParseModuleSlot(*moduleTypeSlot)
 		checkError(err)
+
+		if isModuleOnly {
+			mi, err := logue.GetUserModuleInfo(ctx, *moduleTypeSlot)
+			checkError(err)
+			fmt.Printf("\nSlot:'%s' - Max slot size:%d, Max program size:%d, Slot count:%d\n\n",
+				*moduleTypeSlot,
+				mi.MaxSlotSize,
+				mi.MaxProgramSize,
+				mi.SlotCount,
+			)
+		} else {
+			status, err := logue.GetUserSlotStatus(ctx, *moduleTypeSlot)
+			checkError(err)
+			if status.Empty {
+				fmt.Printf("\nSlot '%s' is empty!\n\n", *moduleTypeSlot)
+			} else {
+				fmt.Printf("\nSlot:'%s' - Name:%s, Ver:%s, API:%s, DevID:%d, ProgID:%d\n\n",
+					*moduleTypeSlot,
+					status.Header.Name,
+					status.Header.Version.VersionString(),
+					status.Header.APIVersion.VersionString(),
+					status.Header.DeveloperID,
+					status.Header.ProgramID,
+				)
+			}
+		}
 	}
 }
 
+func listMidiPorts() {
+
+	ins, outs := logue.MidiPorts()
+
+	fmt.Println("  Available MIDI inputs:")
+	for i, temp := range ins {
+		fmt.Printf("    in %2d: %s\n", i, temp)
+	}
+
+	fmt.Println("\n  Available MIDI outputs:")
+	for i, temp := range outs {
+		fmt.Printf("    out%2d: %s\n", i, temp)
+	}
+
+}
+
+// Exit codes per error class
+const (
+	exitError         = 1
+	exitArgument      = 2
+	exitFile          = 3
+	exitPort          = 4
+	exitCommunication = 5
+	exitDevice        = 6
+	exitCancelled     = 130
+)
+
 func checkError(err error) {
-	if err != nil {
-		fmt.Printf("\nERROR:%s", error.Error(err))
-		os.Exit(-1)
+	if err == nil {
+		return
 	}
+
+	code := exitError
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Printf("\nOperation cancelled!\n")
+		logue.Close()
+		os.Exit(exitCancelled)
+	case errors.Is(err, logue.ErrArgument):
+		code = exitArgument
+	case errors.Is(err, logue.ErrFile):
+		code = exitFile
+	case errors.Is(err, logue.ErrPort):
+		code = exitPort
+	case errors.Is(err, logue.ErrCommunication):
+		code = exitCommunication
+	case errors.Is(err, logue.ErrDevice):
+		code = exitDevice
+	}
+
+	fmt.Printf("\nERROR: %s\n", err)
+	logue.Close()
+	os.Exit(code)
 }
@@ -0,0 +1,121 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func runMorph(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("morph", flag.ContinueOnError)
+	steps := fs.Int("steps", 10, "Number of steps from A to B.")
+	duration := fs.Duration("time", 5*time.Second, "Time from A to B (e.g. 10s).")
+	cc := fs.Int("cc", -1, "Control change number driving the blend. -1 = Use steps over time.")
+	threshold := fs.Float64("threshold", 0.5, "Blend position where discrete parameters switch to B (0-1).")
+
+	sources, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(sources) != 2 {
+		return argumentError("Expected two programs to morph, got %d", len(sources))
+	}
+	if *steps < 1 {
+		return argumentError("Step count must be at least 1")
+	}
+	if *cc > 127 {
+		return argumentError("CC number %d is out of range (0-127)", *cc)
+	}
+
+	a, err := loadProgram(ctx, sources[0])
+	if err != nil {
+		return err
+	}
+	b, err := loadProgram(ctx, sources[1])
+	if err != nil {
+		return err
+	}
+
+	logue.SetProgress(nil)
+
+	send := func(t float64) error {
+		data, err := logue.MorphPrograms(a, b, t, *threshold)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\rMorph %3.0f%%", t*100)
+		return logue.SetProgram(ctx, -1, data)
+	}
+
+	if *cc < 0 {
+		for i := 0; i <= *steps; i++ {
+			if err := send(float64(i) / float64(*steps)); err != nil {
+				return err
+			}
+			if i < *steps {
+				select {
+				case <-time.After(*duration / time.Duration(*steps)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		fmt.Println()
+		return nil
+	}
+
+	events, unsubscribe := logue.SubscribeChannelEvents(64)
+	defer unsubscribe()
+
+	fmt.Printf("Morphing with CC %d (Ctrl-C to stop)...\n", *cc)
+	if err := send(0); err != nil {
+		return err
+	}
+	for {
+		var ev logue.ChannelEvent
+		select {
+		case ev = <-events:
+		case <-ctx.Done():
+			fmt.Println()
+			return nil
+		}
+		if ev.Type != logue.EventControlChange || int(ev.Data1) != *cc {
+			continue
+		}
+
+		// Sending takes a while, skip to the latest value of the controller
+		for latest := true; latest; {
+			select {
+			case next := <-events:
+				if next.Type == logue.EventControlChange && int(next.Data1) == *cc {
+					ev = next
+				}
+			default:
+				latest = false
+			}
+		}
+
+		if err := send(float64(ev.Data2) / 127); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,481 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Package logue is the public Go API for Korg logue series synths.
+//
+// Typical use:
+//
+//	logue.SetDevice(logue.Prologue{DeviceID: 1})
+//	if err := logue.Open(); err != nil { ... }
+//	defer logue.Close()
+//	in, out := logue.FindMidiIO()
+//	if err := logue.SetMidi(in, out); err != nil { ... }
+//	data, err := logue.GetProgram(ctx, 100)
+//
+// Only one device connection is active at a time.
+package logue
+
+import (
+	"context"
+	"io"
+
+	dlg "dialogue/internal/pkg/dialogue"
+	prologue "dialogue/internal/pkg/dialogue/prologue"
+	sysex "dialogue/internal/pkg/dialogue/sysex"
+)
+
+// Device is a logue series synth
+type Device = dlg.Dialogue
+
+// Prologue is Korg prologue synth. DeviceID is the global MIDI channel (1-16).
+type Prologue = dlg.Prologue
+
+// ModuleInfo describes size limits and slot count of user module
+type ModuleInfo = sysex.ModuleInfo
+
+// Header is the header of user unit (name, version, parameters..)
+type Header = sysex.Header
+
+// Module is a user unit (header & payload)
+type Module = sysex.Module
+
+// Program is typed model of prologue program data
+type Program = prologue.Program
+
+// Timbre is the main or sub timbre of a program
+type Timbre = prologue.Timbre
+
+// TimbreID selects main or sub timbre
+type TimbreID = prologue.TimbreID
+
+// Timbres of a program
+const (
+	MainTimbre = prologue.MainTimbre
+	SubTimbre  = prologue.SubTimbre
+)
+
+// Timbre types of Program.TimbreType
+const (
+	TimbreLayer = prologue.TimbreLayer
+	TimbreXfade = prologue.TimbreXfade
+	TimbreSplit = prologue.TimbreSplit
+)
+
+// Multi engine types of Timbre.Multi.Type
+const (
+	MultiNoise = prologue.MultiNoise
+	MultiVPM   = prologue.MultiVPM
+	MultiUser  = prologue.MultiUser
+)
+
+// Modulation effect types of Program.ModFX.Type
+const (
+	ModFXChorus   = prologue.ModFXChorus
+	ModFXEnsemble = prologue.ModFXEnsemble
+	ModFXPhaser   = prologue.ModFXPhaser
+	ModFXFlanger  = prologue.ModFXFlanger
+	ModFXUser     = prologue.ModFXUser
+)
+
+// Difference of one parameter between two programs
+type Difference = prologue.Difference
+
+// Issue is a problem found in program data
+type Issue = prologue.Issue
+
+// SlotRef is a reference from program to user unit slot (e.g. osc/2)
+type SlotRef = prologue.SlotRef
+
+// Query is a search condition over program parameters
+type Query = prologue.Query
+
+// Profile controls program randomization (ranges, locked parameters, seed)
+type Profile = prologue.Profile
+
+// ProgramInfo is the metadata (programmer, comment) of a program in program file
+type ProgramInfo = dlg.ProgramInfo
+
+// SheetProgram is a program on patch sheet
+type SheetProgram = dlg.SheetProgram
+
+// Patch sheet formats
+const (
+	SheetMarkdown = dlg.SheetMarkdown
+	SheetHTML     = dlg.SheetHTML
+)
+
+// BackupManifest describes contents of backup archive
+type BackupManifest = dlg.BackupManifest
+
+// Backup part categories
+const (
+	BackupPrograms = dlg.BackupPrograms
+	BackupUser     = dlg.BackupUser
+	BackupGlobal   = dlg.BackupGlobal
+	BackupTuning   = dlg.BackupTuning
+	BackupLiveset  = dlg.BackupLiveset
+)
+
+// BackupCategories lists all backup part categories in backup & restore order
+var BackupCategories = dlg.BackupCategories
+
+// SlotStatus is the status of one user slot
+type SlotStatus = dlg.SlotStatus
+
+// Pacing defines chunk size & delay of SysEx transmission
+type Pacing = dlg.Pacing
+
+// Progress of a transfer (phase, bytes done & total)
+type Progress = dlg.Progress
+
+// Phase of a transfer
+type Phase = dlg.Phase
+
+// Transfer phases
+const (
+	PhaseEncode  = dlg.PhaseEncode
+	PhaseSend    = dlg.PhaseSend
+	PhaseReceive = dlg.PhaseReceive
+	PhaseDecode  = dlg.PhaseDecode
+)
+
+// ProgressFunc is called during transfers
+type ProgressFunc = dlg.ProgressFunc
+
+// ChannelEvent is a channel message received from device
+type ChannelEvent = dlg.ChannelEvent
+
+// Channel message types of ChannelEvent
+const (
+	EventNoteOff        = dlg.EventNoteOff
+	EventNoteOn         = dlg.EventNoteOn
+	EventPolyAftertouch = dlg.EventPolyAftertouch
+	EventControlChange  = dlg.EventControlChange
+	EventProgramChange  = dlg.EventProgramChange
+	EventAftertouch     = dlg.EventAftertouch
+	EventPitchbend      = dlg.EventPitchbend
+)
+
+// LogLevel of a log message
+type LogLevel = dlg.LogLevel
+
+// Log levels in order of verbosity
+const (
+	LogError   = dlg.LogError
+	LogWarning = dlg.LogWarning
+	LogInfo    = dlg.LogInfo
+	LogDebug   = dlg.LogDebug
+)
+
+// Logger receives log messages
+type Logger = dlg.Logger
+
+// LoggerFunc adapts a function to Logger
+type LoggerFunc = dlg.LoggerFunc
+
+// Direction of a captured SysEx message
+type Direction = dlg.Direction
+
+// Captured message directions
+const (
+	DirectionSent     = dlg.DirectionSent
+	DirectionReceived = dlg.DirectionReceived
+)
+
+// CaptureEntry is a captured SysEx message
+type CaptureEntry = dlg.CaptureEntry
+
+// Error describes failed step with its class and underlying cause
+type Error = dlg.Error
+
+// Error classes, check with errors.Is(err, logue.ErrFile) etc.
+var (
+	ErrArgument      = dlg.ErrArgument
+	ErrFile          = dlg.ErrFile
+	ErrPort          = dlg.ErrPort
+	ErrCommunication = dlg.ErrCommunication
+	ErrDevice        = dlg.ErrDevice
+)
+
+// SetDevice selects the device type used for communication
+func SetDevice(d Device) { dlg.SetDevice(d) }
+
+// EnableDebugging enables debug messages (incl. dumps of sent & received SysEx)
+func EnableDebugging() { dlg.EnableDebugging() }
+
+// NewLogger returns Logger writing one message per line to w
+func NewLogger(w io.Writer) Logger { return dlg.NewLogger(w) }
+
+// SetLogger sets the destination of log messages (default stderr, nil disables)
+func SetLogger(l Logger) { dlg.SetLogger(l) }
+
+// SetLogLevel sets the most verbose level logged (default LogInfo)
+func SetLogLevel(level LogLevel) { dlg.SetLogLevel(level) }
+
+// StartCapture starts recording sent & received SysEx messages to w
+func StartCapture(w io.Writer) error { return dlg.StartCapture(w) }
+
+// StopCapture stops recording. It does not close the writer.
+func StopCapture() { dlg.StopCapture() }
+
+// ReadCapture reads messages recorded with StartCapture
+func ReadCapture(r io.Reader) ([]CaptureEntry, error) { return dlg.ReadCapture(r) }
+
+// SetPacing enables paced SysEx transmission
+func SetPacing(p Pacing) { dlg.SetPacing(p) }
+
+// SetProgress sets the callback for transfer progress (nil disables)
+func SetProgress(f ProgressFunc) { dlg.SetProgress(f) }
+
+// SubscribeChannelEvents returns channel for device's channel messages
+// (knob moves, program selection, notes) and a function to unsubscribe
+func SubscribeChannelEvents(buffer int) (<-chan ChannelEvent, func()) {
+	return dlg.SubscribeChannelEvents(buffer)
+}
+
+// Open initializes the local MIDI driver
+func Open() error { return dlg.Open() }
+
+// Close closes MIDI ports, network session and driver
+func Close() { dlg.Close() }
+
+// MidiPorts returns names of available MIDI inputs & outputs
+func MidiPorts() (ins []string, outs []string) { return dlg.MidiPortNames() }
+
+// FindMidiIO returns indexes of device's MIDI input & output (-1 if not found)
+func FindMidiIO() (in int, out int) { return dlg.FindMidiIO() }
+
+// SetMidi opens MIDI input & output by index
+func SetMidi(in int, out int) error { return dlg.SetMidi(in, out) }
+
+// SetNetworkMidi connects to RTP-MIDI session at address (host:port)
+func SetNetworkMidi(address string) error { return dlg.SetNetworkMidi(address) }
+
+// SetReplayMidi uses capture file as a fake device answering with the
+// recorded replies
+func SetReplayMidi(filename string) error { return dlg.SetReplayMidi(filename) }
+
+// ParseModuleSlot parses "module/slot" or "module" string (e.g. "osc/2")
+func ParseModuleSlot(str string) (moduleID byte, slotID byte, isModuleOnly bool, err error) {
+	return dlg.ParseModuleSlot(str)
+}
+
+// SelectProgram selects program number on device
+func SelectProgram(ctx context.Context, number int) error { return dlg.SelectProgram(ctx, number) }
+
+// GetProgram returns program data. Number out of range means edit buffer.
+func GetProgram(ctx context.Context, number int) ([]byte, error) {
+	return dlg.ReadProgram(ctx, number)
+}
+
+// SetProgram writes program data. Number out of range means edit buffer.
+func SetProgram(ctx context.Context, number int, data []byte) error {
+	return dlg.WriteProgram(ctx, number, data)
+}
+
+// LoadProgramFile returns program data from program file
+func LoadProgramFile(filename string) ([]byte, error) { return dlg.LoadProgramFile(filename) }
+
+// SaveProgramFile writes program data to program file
+func SaveProgramFile(filename string, data []byte) error { return dlg.SaveProgramFile(filename, data) }
+
+// DecodeProgram returns typed model of program data
+func DecodeProgram(data []byte) (Program, error) { return dlg.DecodeProgram(data) }
+
+// EncodeProgram returns program data of typed model
+func EncodeProgram(p Program) []byte { return p.FromProgram() }
+
+// Program text formats
+const (
+	FormatYAML = prologue.FormatYAML
+	FormatJSON = prologue.FormatJSON
+)
+
+// ExportProgram writes program data with named parameters and metadata
+// (FormatYAML or FormatJSON)
+func ExportProgram(w io.Writer, data []byte, info ProgramInfo, format string) error {
+	return dlg.ExportProgram(w, data, info, format)
+}
+
+// ImportProgram reads program written by ExportProgram (YAML or JSON).
+// Values are range checked.
+func ImportProgram(r io.Reader) ([]byte, ProgramInfo, error) { return dlg.ImportProgram(r) }
+
+// DiffPrograms returns parameters that differ between two programs,
+// named like in ExportProgram (e.g. "main.filter.cutoff")
+func DiffPrograms(a []byte, b []byte) ([]Difference, error) { return dlg.DiffPrograms(a, b) }
+
+// RenameProgram returns copy of program data with new name (max 12
+// printable ASCII characters)
+func RenameProgram(data []byte, name string) ([]byte, error) { return dlg.RenameProgram(data, name) }
+
+// LoadPrograms returns all programs of program or library file
+func LoadPrograms(filename string) ([][]byte, error) { return dlg.LoadPrograms(filename) }
+
+// LoadProgramInfo returns metadata of all programs of program or library file
+func LoadProgramInfo(filename string) ([]ProgramInfo, error) { return dlg.LoadProgramInfo(filename) }
+
+// WriteSheet writes programs as patch sheet grouped like the front panel
+// (SheetMarkdown or self-contained SheetHTML)
+func WriteSheet(w io.Writer, programs []SheetProgram, format string) error {
+	return dlg.WriteSheet(w, programs, format)
+}
+
+// ParseQuery parses program search query, e.g. "sync = on and filter.cutoff < 300"
+func ParseQuery(text string) (Query, error) { return dlg.ParseQuery(text) }
+
+// LoadProfile reads randomizer profile (JSON)
+func LoadProfile(filename string) (Profile, error) { return dlg.LoadProfile(filename) }
+
+// SaveProfile writes randomizer profile (JSON)
+func SaveProfile(filename string, pr Profile) error { return dlg.SaveProfile(filename, pr) }
+
+// RandomizeProgram returns copy of base program with unlocked parameters
+// set to random values. Same seed gives the same program.
+func RandomizeProgram(base []byte, pr Profile, seed int64) ([]byte, error) {
+	return dlg.RandomizeProgram(base, pr, seed)
+}
+
+// DeriveProfile returns randomizer profile with ranges covering example programs
+func DeriveProfile(examples [][]byte) (Profile, error) { return dlg.DeriveProfile(examples) }
+
+// MorphPrograms returns blend of programs a and b at position t (0 = a, 1 = b).
+// Discrete parameters (waves, types, slots) switch to b when t reaches threshold.
+func MorphPrograms(a []byte, b []byte, t float64, threshold float64) ([]byte, error) {
+	return dlg.MorphPrograms(a, b, t, threshold)
+}
+
+// CopyTimbre returns copy of program with timbre copied over the other one
+func CopyTimbre(data []byte, from TimbreID, to TimbreID) ([]byte, error) {
+	return dlg.CopyTimbre(data, from, to)
+}
+
+// SwapTimbres returns copy of program with main and sub timbres swapped
+func SwapTimbres(data []byte) ([]byte, error) { return dlg.SwapTimbres(data) }
+
+// LayerTimbres returns program a with timbre t of program b as sub timbre,
+// timbre type set to layer
+func LayerTimbres(a []byte, b []byte, t TimbreID) ([]byte, error) { return dlg.LayerTimbres(a, b, t) }
+
+// ExtractTimbre returns program with timbre t as main timbre and sub timbre
+// turned off, so the timbre can be used as a program of its own
+func ExtractTimbre(data []byte, t TimbreID) ([]byte, error) { return dlg.ExtractTimbre(data, t) }
+
+// SaveProgramFileWithInfo writes program data with programmer and comment
+// to program file
+func SaveProgramFileWithInfo(filename string, data []byte, info ProgramInfo) error {
+	return dlg.SaveProgramFileWithInfo(filename, data, info)
+}
+
+// SaveProgramLibrary writes programs with their programmer and comment (may
+// be shorter than programs) to library file (*.XXXlib)
+func SaveProgramLibrary(filename string, programs [][]byte, infos []ProgramInfo) error {
+	return dlg.SaveProgramLibrary(filename, programs, infos)
+}
+
+// PickProgram returns program of program or library file by number in file
+// (1 = first) or by name
+func PickProgram(filename string, pick string) ([]byte, error) {
+	return dlg.PickProgram(filename, pick)
+}
+
+// UpdateProgramInfo replaces programmer and comment of program (0 = first)
+// in program or library file
+func UpdateProgramInfo(filename string, index int, info ProgramInfo) error {
+	return dlg.UpdateProgramInfo(filename, index, info)
+}
+
+// UpdateProgramFile replaces programs of program or library file in file
+// order, keeping program info
+func UpdateProgramFile(filename string, programs [][]byte) error {
+	return dlg.UpdateProgramFile(filename, programs)
+}
+
+// LintProgram returns problems in program name and parameter values
+func LintProgram(data []byte) ([]Issue, error) { return dlg.LintProgram(data) }
+
+// SanitizeProgram returns copy of program with invalid name characters
+// replaced and values clamped to their ranges
+func SanitizeProgram(data []byte) ([]byte, error) { return dlg.SanitizeProgram(data) }
+
+// ProgramSlotRefs returns user unit slots used by program
+func ProgramSlotRefs(data []byte) ([]SlotRef, error) { return dlg.ProgramSlotRefs(data) }
+
+// DropSlotRef returns copy of program that does not use user slot (multi
+// engine set to noise, or modulation effect turned off)
+func DropSlotRef(data []byte, ref SlotRef) ([]byte, error) { return dlg.DropSlotRef(data, ref) }
+
+// BackupParts returns names of all parts of device memory (e.g.
+// "programs/001", "user/osc/0", "global", "tuning/scale/0", "liveset")
+func BackupParts(ctx context.Context) ([]string, error) { return dlg.BackupParts(ctx) }
+
+// BackupCategory returns category of backup part name
+func BackupCategory(name string) string { return dlg.BackupCategory(name) }
+
+// ReadBackupPart returns data of part from device (nil for empty user slot)
+func ReadBackupPart(ctx context.Context, name string) ([]byte, error) {
+	return dlg.ReadBackupPart(ctx, name)
+}
+
+// WriteBackupPart writes data of part to device (nil clears user slot)
+func WriteBackupPart(ctx context.Context, name string, data []byte) error {
+	return dlg.WriteBackupPart(ctx, name, data)
+}
+
+// DecodeModule returns user unit of module data (e.g. backup part)
+func DecodeModule(data []byte) (Module, error) { return dlg.DecodeModule(data) }
+
+// SaveBackup writes parts to versioned backup archive with manifest
+func SaveBackup(filename string, parts map[string][]byte) error {
+	return dlg.SaveBackup(filename, parts)
+}
+
+// LoadBackup returns manifest and verified parts of backup archive
+func LoadBackup(filename string) (BackupManifest, map[string][]byte, error) {
+	return dlg.LoadBackup(filename)
+}
+
+// GetUserSlot returns user unit in module slot (e.g. "osc/2")
+func GetUserSlot(ctx context.Context, moduleSlot string) (Module, error) {
+	return dlg.ReadUserSlot(ctx, moduleSlot)
+}
+
+// SetUserSlot writes user unit data (from LoadUnitFile) to module slot
+func SetUserSlot(ctx context.Context, moduleSlot string, modData []byte) error {
+	return dlg.WriteUserSlot(ctx, moduleSlot, modData)
+}
+
+// LoadUnitFile returns user unit data from unit file
+func LoadUnitFile(filename string) ([]byte, error) { return dlg.LoadUnitFile(filename) }
+
+// SaveUnitFile writes user unit to unit file
+func SaveUnitFile(filename string, mod Module) error { return dlg.SaveUnitFile(filename, mod) }
+
+// DeleteUserData clears module slot ("osc/2") or all slots of module ("osc")
+func DeleteUserData(ctx context.Context, moduleSlot string) error {
+	return dlg.DeleteUserData(ctx, moduleSlot)
+}
+
+// GetUserModuleInfo returns info of module (e.g. "osc")
+func GetUserModuleInfo(ctx context.Context, module string) (ModuleInfo, error) {
+	return dlg.ReadUserModuleInfo(ctx, module)
+}
+
+// GetUserSlotStatus returns status of module slot (e.g. "osc/2")
+func GetUserSlotStatus(ctx context.Context, moduleSlot string) (SlotStatus, error) {
+	return dlg.ReadUserSlotStatus(ctx, moduleSlot)
+}
@@ -0,0 +1,90 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"dialogue/pkg/logue"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const progressBarWidth = 30
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	// The null device is a character device too
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(fi, null) {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// eachWithProgress calls step for items 0..count-1 of a device operation,
+// showing one line of progress (text from line) instead of a bar per transfer
+func eachWithProgress(count int, line func(i int) string, step func(i int) error) error {
+	logue.SetProgress(nil)
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(os.Stderr, "\r%-70s", line(i))
+		if err := step(i); err != nil {
+			fmt.Fprintln(os.Stderr)
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
+
+// newProgressBar returns progress callback drawing send & receive phases
+// as progress bars, one line per phase
+func newProgressBar() logue.ProgressFunc {
+	var mu sync.Mutex
+
+	return func(p logue.Progress) {
+		if p.Phase != logue.PhaseSend && p.Phase != logue.PhaseReceive {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		var line string
+		if p.Total > 0 {
+			filled := progressBarWidth * p.Done / p.Total
+			line = fmt.Sprintf("\r  %-8s [%s%s] %d/%d bytes",
+				p.Phase,
+				strings.Repeat("#", filled),
+				strings.Repeat(".", progressBarWidth-filled),
+				p.Done,
+				p.Total,
+			)
+		} else {
+			line = fmt.Sprintf("\r  %-8s %d bytes", p.Phase, p.Done)
+		}
+		// Pad to clear the end of a longer previous line
+		fmt.Printf("%-70s", line)
+
+		if p.Total > 0 && p.Done == p.Total {
+			fmt.Println()
+		}
+	}
+}
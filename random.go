@@ -0,0 +1,246 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func randomNeedsDevice(args []string) bool {
+	return len(args) == 0 || args[0] != "derive"
+}
+
+// runRandom sends random programs to edit buffer one at a time. On a terminal
+// one key is an answer; piped input is read as lines.
+func runRandom(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "derive" {
+		return runRandomDerive(args[1:])
+	}
+
+	fs := flag.NewFlagSet("random", flag.ContinueOnError)
+	profileFile := fs.String("profile", "", "Profile file (JSON) with ranges, locked parameters and seed.")
+	seed := fs.Int64("seed", 0, "Seed of the first program. 0 = Seed of profile or random.")
+	baseFile := fs.String("base", "", "Base program for locked parameters. Default = Edit buffer.")
+	dir := fs.String("dir", ".", "Folder for saved programs.")
+
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return argumentError("Unexpected argument '%s'", rest[0])
+	}
+
+	var pr logue.Profile
+	if *profileFile != "" {
+		if pr, err = logue.LoadProfile(*profileFile); err != nil {
+			return err
+		}
+	}
+	if *seed == 0 {
+		*seed = pr.Seed
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano() % 1000000
+	}
+
+	var base []byte
+	if *baseFile != "" {
+		base, _, err = loadProgramFile(*baseFile)
+	} else {
+		base, err = logue.GetProgram(ctx, -1)
+	}
+	if err != nil {
+		return err
+	}
+
+	keys, oneKey := readKeys(os.Stdin)
+	defer restoreTerminal(os.Stdin)
+	prompt := "[Enter] = next, s = save, q = quit: "
+	if !oneKey {
+		prompt = "[Enter] = next, s [Enter] = save, q [Enter] = quit: "
+	}
+	for {
+		data, err := logue.RandomizeProgram(base, pr, *seed)
+		if err != nil {
+			return err
+		}
+		if err := logue.SetProgram(ctx, -1, data); err != nil {
+			return err
+		}
+
+		for answered := false; !answered; {
+			fmt.Printf("\nSeed %d sent to edit buffer. %s", *seed, prompt)
+
+			var line string
+			select {
+			case l, ok := <-keys:
+				if !ok {
+					return nil
+				}
+				line = strings.ToLower(strings.TrimSpace(l))
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			switch line {
+			case "s":
+				filename := filepath.Join(*dir, fmt.Sprintf("random_%d.prlgprog", *seed))
+				if err := logue.SaveProgramFile(filename, data); err != nil {
+					return err
+				}
+				if oneKey {
+					fmt.Println()
+				}
+				fmt.Printf("Saved to '%s'\n", filename)
+			case "q":
+				return nil
+			default:
+				answered = true
+			}
+		}
+		*seed++
+	}
+}
+
+// terminalState is the stty state saved by readKeys
+var terminalState string
+
+// readKeys returns channel of answers read from f (closed at EOF). If f is a
+// terminal and stty can turn off line buffering and echo, every key is an
+// answer (oneKey); otherwise answers are lines. Signals stay enabled, so
+// Ctrl-C works as usual. restoreTerminal undoes the change.
+func readKeys(f *os.File) (answers <-chan string, oneKey bool) {
+	if !isTerminal(f) {
+		return readLines(f), false
+	}
+	state, err := stty(f, "-g")
+	if err != nil {
+		return readLines(f), false
+	}
+	if _, err := stty(f, "-icanon", "-echo", "min", "1", "time", "0"); err != nil {
+		return readLines(f), false
+	}
+	terminalState = strings.TrimSpace(state)
+
+	keys := make(chan string)
+	go func() {
+		r := bufio.NewReader(f)
+		for {
+			c, _, err := r.ReadRune()
+			if err != nil {
+				break
+			}
+			keys <- string(c)
+		}
+		close(keys)
+	}()
+	return keys, true
+}
+
+// restoreTerminal restores terminal state changed by readKeys
+func restoreTerminal(f *os.File) {
+	if terminalState != "" {
+		stty(f, terminalState)
+		terminalState = ""
+	}
+}
+
+// stty runs stty for terminal f
+func stty(f *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = f
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// readLines returns channel of lines read from file (closed at EOF)
+func readLines(f *os.File) <-chan string {
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+	return lines
+}
+
+func runRandomDerive(args []string) error {
+	fs := flag.NewFlagSet("random derive", flag.ContinueOnError)
+	output := fs.String("o", "", "Output profile file.")
+
+	sources, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return argumentError("Missing output file (-o)")
+	}
+	if len(sources) == 0 {
+		return argumentError("Missing example programs")
+	}
+
+	examples, err := collectPrograms(sources)
+	if err != nil {
+		return err
+	}
+
+	pr, err := logue.DeriveProfile(examples)
+	if err != nil {
+		return err
+	}
+
+	if err := logue.SaveProfile(*output, pr); err != nil {
+		return err
+	}
+	fmt.Printf("Profile from %d programs saved to '%s'\n", len(examples), *output)
+	return nil
+}
+
+// collectPrograms returns programs of files and folders (searched recursively)
+func collectPrograms(sources []string) ([][]byte, error) {
+	var programs [][]byte
+	for _, source := range sources {
+		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fileError(err, "Cannot read '%s'", path)
+			}
+			if info.IsDir() || !isProgramFile(path) {
+				return nil
+			}
+			list, err := logue.LoadPrograms(path)
+			programs = append(programs, list...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return programs, nil
+}
@@ -0,0 +1,127 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func searchNeedsDevice(args []string) bool {
+	for _, arg := range args {
+		if arg == "device" {
+			return true
+		}
+	}
+	return false
+}
+
+func isProgramFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".prlgprog" || ext == ".prlglib"
+}
+
+func runSearch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	programRange := fs.String("range", "1-500", "Program range on device.")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return argumentError("Missing query")
+	}
+
+	query, err := logue.ParseQuery(positional[0])
+	if err != nil {
+		return err
+	}
+
+	sources := positional[1:]
+	if len(sources) == 0 {
+		sources = []string{"."}
+	}
+
+	matches := 0
+	for _, source := range sources {
+		if source == "device" {
+			n, err := searchDevice(ctx, query, *programRange)
+			matches += n
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fileError(err, "Cannot read '%s'", path)
+			}
+			if info.IsDir() || !isProgramFile(path) {
+				return nil
+			}
+			programs, err := logue.LoadPrograms(path)
+			if err != nil {
+				return err
+			}
+			for i, data := range programs {
+				if !query.Match(data) {
+					continue
+				}
+				matches++
+				if len(programs) == 1 {
+					fmt.Printf("%s\n", path)
+				} else {
+					fmt.Printf("%s#%d\n", path, i+1)
+				}
+			}
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d matching programs\n", matches)
+	return nil
+}
+
+func searchDevice(ctx context.Context, query logue.Query, programRange string) (int, error) {
+	first, last, err := parseProgramRange(programRange)
+	if err != nil {
+		return 0, err
+	}
+
+	matches := 0
+	err = readPrograms(ctx, first, last, func(n int, data []byte) error {
+		if query.Match(data) {
+			matches++
+			prog, _ := logue.DecodeProgram(data)
+			fmt.Fprintf(os.Stderr, "\r%-70s\r", "")
+			fmt.Printf("%4d  %s\n", n, prog.Name)
+		}
+		return nil
+	})
+	return matches, err
+}
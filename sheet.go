@@ -0,0 +1,116 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runSheet(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sheet", flag.ContinueOnError)
+	format := fs.String("f", "", "Sheet format: md or html (default from output file, else md).")
+	output := fs.String("o", "", "Output file (default stdout).")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return argumentError("Missing program or library file")
+	}
+
+	if *format == "" {
+		*format = logue.SheetMarkdown
+		if ext := strings.ToLower(filepath.Ext(*output)); ext == ".html" || ext == ".htm" {
+			*format = logue.SheetHTML
+		}
+	}
+	if *format != logue.SheetMarkdown && *format != logue.SheetHTML {
+		return argumentError("Unknown sheet format '%s' (md, html)", *format)
+	}
+
+	var programs []logue.SheetProgram
+	for _, source := range positional {
+		err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fileError(err, "Cannot read '%s'", path)
+			}
+			if info.IsDir() || !isProgramFile(path) {
+				return nil
+			}
+			list, err := sheetPrograms(path)
+			programs = append(programs, list...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(programs) == 0 {
+		return argumentError("No programs found")
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fileError(err, "Cannot create '%s'", *output)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := logue.WriteSheet(w, programs, *format); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "%d programs written to '%s'\n", len(programs), *output)
+	}
+	return nil
+}
+
+// sheetPrograms returns programs of program or library file with their metadata
+func sheetPrograms(filename string) ([]logue.SheetProgram, error) {
+	list, err := logue.LoadPrograms(filename)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := logue.LoadProgramInfo(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var programs []logue.SheetProgram
+	for i, data := range list {
+		p := logue.SheetProgram{Source: filename, Data: data}
+		if len(list) > 1 {
+			p.Source = fmt.Sprintf("%s#%d", filename, i+1)
+		}
+		if i < len(infos) {
+			p.Info = infos[i]
+		}
+		programs = append(programs, p)
+	}
+	return programs, nil
+}
@@ -0,0 +1,124 @@
+//
+// Dialogue is a tool for Korg Logue series of synths
+// Copyright (C) 2021 Juha Forstén
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"dialogue/pkg/logue"
+	"flag"
+	"fmt"
+)
+
+func parseTimbre(s string) (logue.TimbreID, error) {
+	switch s {
+	case "main":
+		return logue.MainTimbre, nil
+	case "sub":
+		return logue.SubTimbre, nil
+	}
+	return logue.MainTimbre, argumentError("Unknown timbre '%s' (main, sub)", s)
+}
+
+func runTimbre(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return argumentError("Missing timbre command (copy, swap, layer, extract)")
+	}
+
+	fs := flag.NewFlagSet("timbre "+args[0], flag.ContinueOnError)
+	output := fs.String("o", "", "Output program (file.prlgprog | program number | edit). Default = Source program.")
+
+	rest, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	// Number of arguments: timbre selection and programs
+	expected := map[string]int{"copy": 2, "swap": 1, "layer": 2, "extract": 2}
+	n, ok := expected[args[0]]
+	if !ok {
+		return argumentError("Unknown timbre command '%s'", args[0])
+	}
+	if len(rest) != n {
+		return argumentError("Expected %d arguments for 'timbre %s', got %d", n, args[0], len(rest))
+	}
+
+	var source string
+	var data []byte
+
+	switch args[0] {
+	case "copy", "extract":
+		t, err := parseTimbre(rest[0])
+		if err != nil {
+			return err
+		}
+		source = rest[1]
+		if data, err = loadProgram(ctx, source); err != nil {
+			return err
+		}
+		if args[0] == "copy" {
+			other := logue.SubTimbre
+			if t == logue.SubTimbre {
+				other = logue.MainTimbre
+			}
+			data, err = logue.CopyTimbre(data, t, other)
+		} else {
+			if *output == "" {
+				return argumentError("Missing output program (-o)")
+			}
+			data, err = logue.ExtractTimbre(data, t)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "swap":
+		source = rest[0]
+		if data, err = loadProgram(ctx, source); err != nil {
+			return err
+		}
+		if data, err = logue.SwapTimbres(data); err != nil {
+			return err
+		}
+
+	case "layer":
+		if *output == "" {
+			return argumentError("Missing output program (-o)")
+		}
+		a, err := loadProgram(ctx, rest[0])
+		if err != nil {
+			return err
+		}
+		b, err := loadProgram(ctx, rest[1])
+		if err != nil {
+			return err
+		}
+		if data, err = logue.LayerTimbres(a, b, logue.MainTimbre); err != nil {
+			return err
+		}
+	}
+
+	target := *output
+	if target == "" {
+		target = source
+	}
+	if err := saveProgram(ctx, target, data); err != nil {
+		return err
+	}
+	fmt.Printf("\nProgram saved to '%s'\n", target)
+	return nil
+}